@@ -22,6 +22,9 @@ func (app *application) generateAccountObject(user models.User) map[string]any {
 		"image":       user.Image,
 		"messages":    user.Messages,
 		"is_admin":    user.IsAdmin,
+
+		"location_precision": user.LocationPrecision,
+		"mentions_enabled":   user.MentionsEnabled,
 	}
 }
 
@@ -147,6 +150,12 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	return ok
 }
 
+func (app *application) isAdmin(r *http.Request) bool {
+	user, ok := r.Context().Value(UserContextKey).(*models.User)
+
+	return ok && user.IsAdmin
+}
+
 func (app *application) requireAuthentication(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.isAuthenticated(r) {
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 var ErrInvalidToken = fmt.Errorf("invalid token")
@@ -44,6 +47,10 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusForbidden, err.Error())
+}
+
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.errorResponse(w, r, http.StatusNotFound, err.Error())
 }
@@ -57,3 +64,30 @@ func (app *application) methodNotAllowedHandler(w http.ResponseWriter, r *http.R
 	message := fmt.Sprintf("%s method is not supported for this resource", r.Method)
 	app.errorResponse(w, r, http.StatusNotFound, message)
 }
+
+// tooManyRequestsResponse tells the client how many whole seconds to wait
+// both in the Retry-After header and the body.
+func (app *application) tooManyRequestsResponse(w http.ResponseWriter, r *http.Request, message string, seconds int) {
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	err := app.writeJSON(w, http.StatusTooManyRequests, envelope{"error": message, "retry_after": seconds}, nil)
+	if err != nil {
+		app.logError(r, err, "tooManyRequestsResponse")
+		w.WriteHeader(500)
+	}
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := retryAfterSeconds(retryAfter)
+	app.tooManyRequestsResponse(w, r, fmt.Sprintf("rate limit exceeded, try again in %d seconds", seconds), seconds)
+}
+
+func (app *application) slowModeResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := retryAfterSeconds(retryAfter)
+	app.tooManyRequestsResponse(w, r, fmt.Sprintf("slow mode is on, you can send another message in %d seconds", seconds), seconds)
+}
+
+// retryAfterSeconds rounds up so clients never retry too early.
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
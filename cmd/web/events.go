@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"globechat.live/internal/models"
+)
+
+const (
+	MaxEventDuration = 7 * 24 * time.Hour
+	MaxEventLeadTime = 365 * 24 * time.Hour // how far ahead an event can be scheduled
+)
+
+type eventInput struct {
+	// RFC 3339, or a local time like 2006-01-02T15:04 in Timezone
+	StartsAt string `json:"starts_at"`
+	EndsAt   string `json:"ends_at"`
+	Timezone string `json:"timezone"`
+}
+
+func (input eventInput) toEvent(now time.Time) (models.Event, error) {
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+
+	loc, err := time.LoadLocation(input.Timezone)
+	if err != nil {
+		return models.Event{}, fmt.Errorf("unknown timezone %q", input.Timezone)
+	}
+
+	startsAt, err := parseEventTime(input.StartsAt, loc)
+	if err != nil {
+		return models.Event{}, fmt.Errorf("starts_at %w", err)
+	}
+
+	endsAt, err := parseEventTime(input.EndsAt, loc)
+	if err != nil {
+		return models.Event{}, fmt.Errorf("ends_at %w", err)
+	}
+
+	switch {
+	case !endsAt.After(startsAt):
+		return models.Event{}, fmt.Errorf("event must end after it starts")
+	case !endsAt.After(now):
+		return models.Event{}, fmt.Errorf("event has already ended")
+	case endsAt.Sub(startsAt) > MaxEventDuration:
+		return models.Event{}, fmt.Errorf("event can't last longer than %d days", int(MaxEventDuration.Hours()/24))
+	case startsAt.Sub(now) > MaxEventLeadTime:
+		return models.Event{}, fmt.Errorf("event can't start more than a year from now")
+	}
+
+	return models.Event{
+		StartsAt: startsAt,
+		EndsAt:   endsAt,
+		Timezone: loc.String(),
+	}, nil
+}
+
+func parseEventTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("must be a valid date and time")
+}
+
+func (app *application) getUpcomingEventsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	query := models.UpcomingQuery{Limit: 50}
+
+	if qs.Has("minLat") {
+		boxes, err := app.readBounds(qs)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		query.Boxes = boxes
+	}
+
+	if qs.Has("limit") {
+		limit, err := strconv.Atoi(qs.Get("limit"))
+		if err != nil || limit < 1 || limit > 100 {
+			app.badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and 100"))
+			return
+		}
+		query.Limit = limit
+	}
+
+	if qs.Has("days") {
+		days, err := strconv.Atoi(qs.Get("days"))
+		if err != nil || days < 1 || days > 365 {
+			app.badRequestResponse(w, r, fmt.Errorf("days must be between 1 and 365"))
+			return
+		}
+		query.Before = time.Now().AddDate(0, 0, days)
+	}
+
+	events, err := app.eventModel.GetUpcoming(query)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching upcoming events")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"events": events}, nil)
+}
+
+func (app *application) rsvpEventHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	event, ok := app.readEvent(w, r)
+	if !ok {
+		return
+	}
+
+	if event.Ended {
+		app.forbiddenResponse(w, r, fmt.Errorf("event has ended"))
+		return
+	}
+
+	err := app.eventModel.AddRSVP(event.ThreadId, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "rsvp to event")
+		return
+	}
+
+	app.notifyEventUpdate(w, r, event.ThreadId)
+}
+
+func (app *application) cancelRSVPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	event, ok := app.readEvent(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.eventModel.RemoveRSVP(event.ThreadId, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("you haven't rsvped to this event"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "cancel rsvp")
+		return
+	}
+
+	app.notifyEventUpdate(w, r, event.ThreadId)
+}
+
+func (app *application) getRSVPsHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readEvent(w, r)
+	if !ok {
+		return
+	}
+
+	rsvps, err := app.eventModel.GetRSVPs(event.ThreadId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching rsvps")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"rsvps": rsvps}, nil)
+}
+
+// readEvent loads the event of the thread in the :id parameter, writing the
+// error response itself when there isn't one or the thread is deleted or
+// hidden from the user.
+func (app *application) readEvent(w http.ResponseWriter, r *http.Request) (models.Event, bool) {
+	threadId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return models.Event{}, false
+	}
+
+	thread, err := app.threadModel.GetById(threadId)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return models.Event{}, false
+	}
+
+	if err != nil || !app.canSeeThread(r, thread) {
+		app.notFoundResponse(w, r, fmt.Errorf("event not found"))
+		return models.Event{}, false
+	}
+
+	event, err := app.eventModel.GetByThreadId(threadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("event not found"))
+			return models.Event{}, false
+		}
+		app.serverErrorResponse(w, r, err, "fetching event")
+		return models.Event{}, false
+	}
+
+	return event, true
+}
+
+// notifyEventUpdate sends the event with its new RSVP count to the thread's
+// room and as the response.
+func (app *application) notifyEventUpdate(w http.ResponseWriter, r *http.Request, threadId int) {
+	event, err := app.eventModel.GetByThreadId(threadId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching event")
+		return
+	}
+
+	app.roomManager.notifyRoom(threadId, WebsocketConnectionMessage{
+		Type:   "event-update",
+		RoomID: threadId,
+		Data:   event,
+	})
+
+	app.writeJSON(w, 200, envelope{"event": event}, nil)
+}
+
+// endPastEvents locks the threads of events that have finished and tells
+// anyone still in the room.
+func (app *application) endPastEvents() error {
+	threadIds, err := app.eventModel.EndPast(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, threadId := range threadIds {
+		thread, err := app.threadModel.GetById(threadId)
+		if err != nil {
+			// Deleted since, the rest of the batch still needs its event
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			}
+			return err
+		}
+
+		app.roomManager.notifyRoom(threadId, WebsocketConnectionMessage{
+			Type:   "lock-thread",
+			RoomID: threadId,
+			Data:   thread,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"globechat.live/internal/models"
+)
+
+func TestRSVPsFollowTheirThread(t *testing.T) {
+	tests := []struct {
+		name   string
+		thread fakeThread
+		user   *models.User
+		status int
+	}{
+		{"visible", fakeThread{}, &models.User{ID: 3}, http.StatusOK},
+		{"held from a third party", fakeThread{held: true}, &models.User{ID: 3}, http.StatusNotFound},
+		{"held from anonymous", fakeThread{held: true}, nil, http.StatusNotFound},
+		{"held from the owner", fakeThread{held: true}, &models.User{ID: 1}, http.StatusOK},
+		{"deleted", fakeThread{deletedAt: time.Now()}, &models.User{ID: 1}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openFakeDB(t, func(query string, args []driver.Value) fakeResult {
+				switch {
+				case strings.HasPrefix(query, "SELECT threads.id, threads.lat"):
+					// GetById leaves deleted threads out
+					if tt.thread.deletedAt != nil {
+						return fakeResult{}
+					}
+					return tt.thread.result()
+				case strings.HasPrefix(query, "SELECT events.thread_id"):
+					now := time.Now()
+					return fakeResult{columns: make([]string, 6), rows: [][]driver.Value{{
+						int64(7), now, now.Add(time.Hour), "UTC", false, int64(0),
+					}}}
+				}
+				return fakeResult{}
+			})
+			app := &application{
+				logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+				threadModel: models.ThreadModel{DB: db},
+				eventModel:  models.EventModel{DB: db},
+				pollModel:   models.PollModel{DB: db},
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/threads/7/rsvps", nil)
+			ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "7"}})
+			if tt.user != nil {
+				ctx = context.WithValue(ctx, UserContextKey, tt.user)
+			}
+
+			w := httptest.NewRecorder()
+			app.getRSVPsHandler(w, r.WithContext(ctx))
+
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
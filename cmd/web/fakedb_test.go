@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResult is what a fakeHandler returns for one statement.
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// fakeHandler answers the statements of a test, an empty result stands for
+// no rows.
+type fakeHandler func(query string, args []driver.Value) fakeResult
+
+var (
+	fakeMu       sync.Mutex
+	fakeHandlers = map[string]fakeHandler{}
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+// openFakeDB returns a database answered by handler for the rest of the
+// test, so handlers can run without Postgres.
+func openFakeDB(t *testing.T, handler fakeHandler) *sql.DB {
+	t.Helper()
+
+	fakeMu.Lock()
+	fakeHandlers[t.Name()] = handler
+	fakeMu.Unlock()
+
+	db, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		fakeMu.Lock()
+		delete(fakeHandlers, t.Name())
+		fakeMu.Unlock()
+	})
+
+	return db
+}
+
+// fakeThread answers the thread queries built on threadColumns with thread
+// 7, owned by user 1.
+type fakeThread struct {
+	held            bool
+	deletedAt       any
+	slowModeSeconds int64
+}
+
+func (f fakeThread) result() fakeResult {
+	now := time.Now()
+	return fakeResult{columns: make([]string, 20), rows: [][]driver.Value{{
+		int64(7), 51.5, -0.12, "thread", int64(1), now,
+		"owner", "", "", "", nil,
+		false, false, int64(0), now,
+		f.held, f.deletedAt, nil, false, f.slowModeSeconds,
+	}}}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+
+	handler, ok := fakeHandlers[name]
+	if !ok {
+		return nil, fmt.Errorf("no fake database named %q", name)
+	}
+	return fakeConn{handler}, nil
+}
+
+type fakeConn struct {
+	handler fakeHandler
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{c.handler, query}, nil
+}
+
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	handler fakeHandler
+	query   string
+}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	result := s.handler(strings.Join(strings.Fields(s.query), " "), args)
+	return &fakeRows{result: result}, nil
+}
+
+type fakeRows struct {
+	result fakeResult
+	next   int
+}
+
+func (r *fakeRows) Columns() []string { return r.result.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+	return nil
+}
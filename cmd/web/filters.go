@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"globechat.live/internal/filter"
+	"globechat.live/internal/models"
+)
+
+var errFiltered = errors.New("this was blocked by a content filter")
+
+// filterCache holds the chain built from the enabled rules, rebuilt whenever
+// the rules change and periodically so every instance catches up.
+type filterCache struct {
+	mu    sync.RWMutex
+	chain *filter.Chain
+}
+
+func (c *filterCache) get() *filter.Chain {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.chain
+}
+
+func (c *filterCache) set(chain *filter.Chain) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.chain = chain
+}
+
+// reloadFilters rebuilds the filter chain from the database. Rules that no
+// longer compile are skipped rather than blocking every other rule.
+func (app *application) reloadFilters() error {
+	rules, err := app.filterModel.GetEnabledRules()
+	if err != nil {
+		return err
+	}
+
+	compiled := make([]filter.Rule, 0, len(rules))
+	for _, rule := range rules {
+		f, err := filter.Compile(rule.Kind, rule.Pattern)
+		if err != nil {
+			app.logger.Warn("skipping invalid filter rule", "rule", rule.ID, "error", err.Error())
+			continue
+		}
+		compiled = append(compiled, filter.Rule{ID: rule.ID, Action: filter.Action(rule.Action), Filter: f})
+	}
+
+	app.filters.set(filter.NewChain(compiled...))
+	return nil
+}
+
+// filterText runs text through the content filters and logs what matched.
+// It writes the error response itself when the text is rejected, otherwise
+// it returns the text to store and who may see it.
+func (app *application) filterText(w http.ResponseWriter, r *http.Request, text string, userId int, target string) (string, models.Visibility, bool) {
+	result := app.filters.get().Apply(text)
+
+	if len(result.Hits) > 0 {
+		hits := make([]models.FilterHit, len(result.Hits))
+		for i, hit := range result.Hits {
+			hits[i] = models.FilterHit{
+				RuleId:  hit.RuleID,
+				UserId:  userId,
+				Target:  target,
+				Action:  string(hit.Action),
+				Text:    text,
+				Matched: hit.Match,
+			}
+		}
+
+		// Losing a log entry shouldn't stop anyone from posting
+		if err := app.filterModel.LogHits(hits); err != nil {
+			app.logError(r, err, "logging filter hits")
+		}
+	}
+
+	switch result.Action {
+	case filter.Reject:
+		app.badRequestResponse(w, r, errFiltered)
+		return "", "", false
+	case filter.Hold:
+		return result.Text, models.VisibilityHeld, true
+	case filter.Shadow:
+		return result.Text, models.VisibilityShadow, true
+	default:
+		return result.Text, models.VisibilityPublic, true
+	}
+}
+
+// filterEdit filters the new text of an edit. Edited content was already
+// public, so rules that would hold or shadow it reject the edit instead.
+func (app *application) filterEdit(w http.ResponseWriter, r *http.Request, text string, userId int, target string) (string, bool) {
+	text, visibility, ok := app.filterText(w, r, text, userId, target)
+	if !ok {
+		return "", false
+	}
+
+	if visibility != models.VisibilityPublic {
+		app.badRequestResponse(w, r, errFiltered)
+		return "", false
+	}
+
+	return text, true
+}
+
+type filterRuleInput struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+	// Defaults to true
+	Enabled *bool  `json:"enabled"`
+	Note    string `json:"note"`
+}
+
+func (input filterRuleInput) toRule() (models.FilterRule, error) {
+	rule := models.FilterRule{
+		Kind:    input.Kind,
+		Pattern: strings.TrimSpace(input.Pattern),
+		Action:  input.Action,
+		Enabled: input.Enabled == nil || *input.Enabled,
+		Note:    strings.TrimSpace(input.Note),
+	}
+
+	if len(rule.Pattern) > 10000 {
+		return models.FilterRule{}, fmt.Errorf("pattern must not be longer than 10000 characters")
+	}
+
+	if len(rule.Note) > 280 {
+		return models.FilterRule{}, fmt.Errorf("note must not be longer than 280 characters")
+	}
+
+	if _, err := filter.ParseAction(rule.Action); err != nil {
+		return models.FilterRule{}, err
+	}
+
+	if _, err := filter.Compile(rule.Kind, rule.Pattern); err != nil {
+		return models.FilterRule{}, err
+	}
+
+	return rule, nil
+}
+
+func (app *application) getFilterRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := app.filterModel.GetRules()
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching filter rules")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"rules": rules}, nil)
+}
+
+func (app *application) createFilterRuleHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	var input filterRuleInput
+
+	err := app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	rule, err := input.toRule()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	rule.CreatedBy = &user.ID
+
+	rule, err = app.filterModel.CreateRule(rule)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "create filter rule")
+		return
+	}
+
+	app.afterFilterChange(r)
+	app.writeJSON(w, 200, envelope{"rule": rule}, nil)
+}
+
+func (app *application) updateFilterRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ruleId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input filterRuleInput
+
+	err = app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	rule, err := input.toRule()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	rule.ID = ruleId
+
+	rule, err = app.filterModel.UpdateRule(rule)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("filter rule not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "update filter rule")
+		return
+	}
+
+	app.afterFilterChange(r)
+	app.writeJSON(w, 200, envelope{"rule": rule}, nil)
+}
+
+func (app *application) deleteFilterRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ruleId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.filterModel.DeleteRule(ruleId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("filter rule not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "delete filter rule")
+		return
+	}
+
+	app.afterFilterChange(r)
+	app.writeJSON(w, 200, envelope{"message": "filter rule deleted"}, nil)
+}
+
+// afterFilterChange applies a rule change right away on this instance. The
+// change is already saved, so a failure is only logged and left to the
+// periodic reload.
+func (app *application) afterFilterChange(r *http.Request) {
+	if err := app.reloadFilters(); err != nil {
+		app.logError(r, err, "reloading filter rules")
+	}
+}
+
+// getFilterHitsHandler pages through the filter hit log, newest first,
+// optionally only for one rule.
+func (app *application) getFilterHitsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	query := models.FilterHitQuery{}
+
+	var err error
+	query.Limit, err = app.readInt(qs, "limit", 50)
+	if err != nil || query.Limit < 1 || query.Limit > 100 {
+		app.badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and 100"))
+		return
+	}
+
+	if qs.Has("rule_id") {
+		query.RuleId, err = strconv.Atoi(qs.Get("rule_id"))
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("rule_id must be a valid number"))
+			return
+		}
+	}
+
+	query.Cursor, err = app.readCursor(qs)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	hits, page, err := app.filterModel.GetHits(query)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching filter hits")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"hits": hits, "next": page.Next, "prev": page.Prev, "has_more": page.HasMore}, nil)
+}
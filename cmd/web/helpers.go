@@ -11,6 +11,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"globechat.live/internal/models"
 )
 
 type envelope map[string]any
@@ -39,6 +42,32 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int) (in
 	return i, nil
 }
 
+// readIDParam reads the numeric :id route parameter
+func (app *application) readIDParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return 0, fmt.Errorf("id must be a valid number")
+	}
+
+	return id, nil
+}
+
+// readCursor reads the optional opaque cursor query parameter
+func (app *application) readCursor(qs url.Values) (*models.Cursor, error) {
+	if qs.Get("cursor") == "" {
+		return nil, nil
+	}
+
+	cursor, err := models.DecodeCursor(qs.Get("cursor"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
 func (app *application) readJSON(r io.Reader, dst any) error {
 	dec := json.NewDecoder(r)
 
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+)
+
+// runPeriodically runs job every interval in the background until the
+// process exits. Failures are logged and the job is retried on the next tick.
+func (app *application) runPeriodically(name string, interval time.Duration, job func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := job(); err != nil {
+				app.logger.Error(err.Error(), "job", name)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (app *application) startBackgroundJobs() {
+	app.runPeriodically("refresh trending scores", app.config.trendingInterval, app.threadModel.RefreshTrendingScores)
+	app.runPeriodically("end past events", app.config.eventInterval, app.endPastEvents)
+	app.runPeriodically("delete unused uploads", time.Hour, app.deleteUnusedUploads)
+	app.runPeriodically("reconcile reply counts", app.config.reconcileInterval, app.reconcileReplies)
+	app.runPeriodically("purge deleted content", time.Hour, app.purgeDeleted)
+	app.runPeriodically("reload content filters", time.Minute, app.reloadFilters)
+	app.runPeriodically("prune rate limits", 10*time.Minute, app.pruneRateLimits)
+	app.runPeriodically("shuffle random keys", 10*time.Minute, app.threadModel.ShuffleRandomKeys)
+	app.startUnfurlWorkers()
+}
+
+func (app *application) reconcileReplies() error {
+	fixed, err := app.threadModel.ReconcileReplies()
+	if err != nil {
+		return err
+	}
+
+	if fixed > 0 {
+		app.logger.Warn("fixed drifted reply counts", "threads", fixed)
+	}
+
+	return nil
+}
+
+// purgeDeleted permanently removes messages and threads that were deleted
+// longer than the retention period ago, along with their reports.
+func (app *application) purgeDeleted() error {
+	before := time.Now().Add(-app.config.deletedRetention)
+
+	messages, err := app.messageModel.PurgeDeleted(before)
+	if err != nil {
+		return err
+	}
+
+	threads, err := app.threadModel.PurgeDeleted(before)
+	if err != nil {
+		return err
+	}
+
+	if messages > 0 || threads > 0 {
+		app.logger.Info("purged deleted content", "messages", messages, "threads", threads)
+	}
+
+	return nil
+}
@@ -12,7 +12,10 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"globechat.live/internal/geo"
 	"globechat.live/internal/models"
+	"globechat.live/internal/ratelimit"
+	"globechat.live/internal/unfurl"
 )
 
 type config struct {
@@ -21,18 +24,54 @@ type config struct {
 	dsn            string
 	googleClientId string
 	mediaDir       string
+
+	trendingInterval  time.Duration
+	reconcileInterval time.Duration
+	eventInterval     time.Duration
+	locationPrecision geo.Precision
+	citiesFile        string
+
+	threadSpacingKm   float64
+	threadLimit       int
+	messageEditWindow time.Duration
+	unfurlTimeout     time.Duration
+	unfurlCacheTTL    time.Duration
+	uploadTTL         time.Duration
+	deletedRetention  time.Duration
+
+	rateLimits rateLimitFlag
+	// Header a reverse proxy puts the client's IP address in
+	realIPHeader string
 }
 
 type application struct {
-	logger       *slog.Logger
-	db           *sql.DB
-	config       config
-	userModel    models.UserModel
-	sessionModel models.SessionModel
-	threadModel  models.ThreadModel
-	messageModel models.MessageModel
-	reportModel  models.ReportModel
-	roomManager  WebSocketRoomManager
+	logger            *slog.Logger
+	db                *sql.DB
+	config            config
+	userModel         models.UserModel
+	sessionModel      models.SessionModel
+	threadModel       models.ThreadModel
+	messageModel      models.MessageModel
+	reportModel       models.ReportModel
+	watchModel        models.WatchModel
+	zoneModel         models.ZoneModel
+	eventModel        models.EventModel
+	pollModel         models.PollModel
+	reactionModel     models.ReactionModel
+	notificationModel models.NotificationModel
+	previewModel      models.LinkPreviewModel
+	uploadModel       models.UploadModel
+	filterModel       models.FilterModel
+	roomManager       WebSocketRoomManager
+	geocoder          *geo.Geocoder
+	tileCache         *tileCache
+	filters           *filterCache
+	rateLimiter       *ratelimit.Limiter
+	unfurler          unfurl.Fetcher
+	// Messages waiting for their link previews
+	unfurlQueue chan unfurlJob
+	// Held while an upload is decoded, see MaxConcurrentUploads
+	uploadSlots chan struct{}
 }
 
 func openDB(cfg config) (*sql.DB, error) {
@@ -56,13 +95,34 @@ func openDB(cfg config) (*sql.DB, error) {
 }
 
 func main() {
-	var cfg config
+	cfg := config{
+		locationPrecision: geo.Precision100m,
+		rateLimits:        newRateLimitFlag(),
+	}
 
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "the environment the api server is running on")
 	flag.StringVar(&cfg.dsn, "dsn", "", "dsn string to connect to postgres DB")
 	flag.StringVar(&cfg.googleClientId, "gclientid", "", "google client id for oauth")
 	flag.StringVar(&cfg.mediaDir, "mediadir", "./media", "directory to store uploaded media files")
+	flag.Func("locationprecision", "default precision new thread locations are snapped to (exact, 100m, 1km or city)", func(s string) error {
+		precision, err := geo.ParsePrecision(s)
+		cfg.locationPrecision = precision
+		return err
+	})
+	flag.StringVar(&cfg.citiesFile, "citiesfile", "", "GeoNames cities dump used to label threads with place names (optional)")
+	flag.Float64Var(&cfg.threadSpacingKm, "threadspacing", 0.05, "minimum distance in km between threads")
+	flag.IntVar(&cfg.threadLimit, "threadlimit", 10, "maximum number of threads a user can have at once")
+	flag.DurationVar(&cfg.trendingInterval, "trendinginterval", 5*time.Minute, "how often trending thread scores are recomputed")
+	flag.DurationVar(&cfg.messageEditWindow, "messageeditwindow", 15*time.Minute, "how long after posting a message can be edited")
+	flag.DurationVar(&cfg.unfurlTimeout, "unfurltimeout", unfurl.DefaultTimeout, "how long fetching a link preview may take")
+	flag.DurationVar(&cfg.unfurlCacheTTL, "unfurlcachettl", 24*time.Hour, "how long link previews are cached")
+	flag.DurationVar(&cfg.uploadTTL, "uploadttl", 24*time.Hour, "how long uploads not attached to a message are kept")
+	flag.DurationVar(&cfg.deletedRetention, "deletedretention", 30*24*time.Hour, "how long deleted messages and threads are kept for moderators before being purged")
+	flag.DurationVar(&cfg.eventInterval, "eventinterval", time.Minute, "how often finished events are closed")
+	flag.DurationVar(&cfg.reconcileInterval, "reconcileinterval", time.Hour, "how often thread reply counts are checked against their messages")
+	flag.Var(cfg.rateLimits, "ratelimit", "rate limit of an action like message.create=5/10s or thread.create=off, can be repeated (actions: thread.create, message.create, report.create, ws.join, upload.create)")
+	flag.StringVar(&cfg.realIPHeader, "realipheader", "", "header a trusted reverse proxy sets to the client IP, like X-Forwarded-For (optional)")
 	flag.Parse()
 
 	if strings.TrimSpace(cfg.dsn) == "" {
@@ -92,6 +152,16 @@ func main() {
 
 	logger.Info("database connection pool establised")
 
+	var geocoder *geo.Geocoder
+	if cfg.citiesFile != "" {
+		geocoder, err = geo.LoadCities(cfg.citiesFile)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("cities dataset loaded", "places", geocoder.Len())
+	}
+
 	app := application{
 		logger: logger,
 		db:     db,
@@ -111,9 +181,45 @@ func main() {
 		reportModel: models.ReportModel{
 			DB: db,
 		},
+		watchModel: models.WatchModel{
+			DB: db,
+		},
+		zoneModel: models.ZoneModel{
+			DB: db,
+		},
+		eventModel: models.EventModel{
+			DB: db,
+		},
+		pollModel: models.PollModel{
+			DB: db,
+		},
+		reactionModel: models.ReactionModel{
+			DB: db,
+		},
+		notificationModel: models.NotificationModel{
+			DB: db,
+		},
+		previewModel: models.LinkPreviewModel{
+			DB: db,
+		},
+		uploadModel: models.UploadModel{
+			DB: db,
+		},
+		filterModel: models.FilterModel{
+			DB: db,
+		},
 		roomManager: *NewWebSocketRoomManager(),
+		geocoder:    geocoder,
+		tileCache:   newTileCache(),
+		filters:     &filterCache{},
+		rateLimiter: ratelimit.New(cfg.rateLimits),
+		unfurler:    unfurl.NewHTTPFetcher(cfg.unfurlTimeout, unfurl.DefaultMaxBytes, false),
+		unfurlQueue: make(chan unfurlJob, MaxQueuedUnfurls),
+		uploadSlots: make(chan struct{}, MaxConcurrentUploads),
 	}
 
+	app.startBackgroundJobs()
+
 	srv := http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.port),
 		Handler:      app.routes(),
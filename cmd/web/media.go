@@ -26,8 +26,13 @@ func (app *application) saveProfilePicture(img image.Image, filename string) err
 	// Create the full file path
 	filePath := filepath.Join(profilePicturesDir, filename)
 
+	return saveJPEG(img, filePath)
+}
+
+// saveJPEG encodes img as a JPEG file at path.
+func saveJPEG(img image.Image, path string) error {
 	// Create the file
-	file, err := os.Create(filePath)
+	file, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -15,47 +16,184 @@ func (app *application) createMessageHandler(w http.ResponseWriter, r *http.Requ
 
 	user := app.getUserFromRequst(r)
 
-	lastCreated, err := app.messageModel.GetLastCreatedAtByUser(user.ID)
-	if err == nil {
-		// If we have a lastCreated time, enforce a 1-second minimum gap between messages.
-		if !lastCreated.IsZero() && time.Since(lastCreated) < time.Second {
-			app.writeJSON(w, http.StatusTooManyRequests, envelope{
-				"error": "You are sending messages too quickly. Please wait a moment before sending another message.",
-			}, nil)
-			return
-		}
-	}
-
 	var input struct {
 		ThreadId int    `json:"thread_id"`
 		Text     string `json:"text"`
 		Image    string `json:"image"`
+		// Id returned by POST /api/v1/uploads
+		UploadId string `json:"upload_id"`
+		// Optional message in the same thread this one answers
+		ReplyToId *int `json:"reply_to_id"`
+		// Optional poll attached to the message
+		Poll *pollInput `json:"poll"`
 	}
 
-	err = app.readJSONFromRequest(w, r, &input)
+	err := app.readJSONFromRequest(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	message, err := app.messageModel.Create(input.Text, input.Image, input.ThreadId, user.ID, false)
+	// Images used to be arbitrary URLs, they now have to be uploaded first
+	if input.Image != "" {
+		app.badRequestResponse(w, r, fmt.Errorf("images must be uploaded through /api/v1/uploads and sent as upload_id"))
+		return
+	}
 
-	if err != nil {
-		if errors.Is(err, models.ErrTextTooLong) {
+	var upload *models.Upload
+	if input.UploadId != "" {
+		u, err := app.uploadModel.GetById(input.UploadId)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverErrorResponse(w, r, err, "fetching upload")
+			return
+		}
+
+		if err != nil || u.UserId != user.ID {
+			app.badRequestResponse(w, r, fmt.Errorf("upload_id must be one of your uploads"))
+			return
+		}
+		upload = &u
+	}
+
+	if input.Poll != nil {
+		if err = input.Poll.validate(time.Now()); err != nil {
 			app.badRequestResponse(w, r, err)
 			return
 		}
-		app.serverErrorResponse(w, r, err, "create message")
+	}
+
+	thread, err := app.threadModel.GetById(input.ThreadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	if !app.canSeeThread(r, thread) {
+		app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+		return
+	}
+
+	if thread.Locked {
+		app.forbiddenResponse(w, r, models.ErrThreadLocked)
+		return
+	}
+
+	rules, err := app.zoneModel.GetRules(thread.Lat, thread.Long)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching zone rules")
+		return
+	}
+
+	if rules.ReadOnly {
+		app.forbiddenResponse(w, r, fmt.Errorf("%s is read-only", zoneNames(rules.Zones)))
+		return
+	}
+
+	if input.ReplyToId != nil {
+		parent, err := app.messageModel.GetByID(*input.ReplyToId)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverErrorResponse(w, r, err, "fetching reply parent")
+			return
+		}
+
+		if err != nil || parent.ThreadId != input.ThreadId || !app.canSeeMessage(r, parent) {
+			app.badRequestResponse(w, r, fmt.Errorf("reply_to_id must be a message in the same thread"))
+			return
+		}
+	}
+
+	text, visibility, ok := app.filterText(w, r, input.Text, user.ID, models.FilterTargetMessage)
+	if !ok {
+		return
+	}
+
+	message, err := app.messageModel.Create(text, upload, input.ThreadId, user.ID, false, input.ReplyToId, visibility, app.slowModeFor(r, thread))
+
+	if err != nil {
+		var slowModeErr *models.SlowModeError
+		switch {
+		case errors.As(err, &slowModeErr):
+			app.slowModeResponse(w, r, slowModeErr.Remaining)
+		case errors.Is(err, models.ErrTextTooLong) || errors.Is(err, models.ErrUploadInUse):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err, "create message")
+		}
 		return
 	}
 
-	app.roomManager.notifyRoom(input.ThreadId, WebsocketConnectionMessage{
+	if input.Poll != nil {
+		poll, err := app.createPoll(input.Poll, input.ThreadId, &message.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err, "create poll")
+			app.messageModel.Purge(message.ID)
+			return
+		}
+		message.Poll = &poll
+	}
+
+	app.publishMessage(r, message)
+	app.unfurlMessage(message)
+
+	app.writeJSON(w, 200, envelope{"message": message}, nil)
+}
+
+// publishMessage sends a new message to its thread's room and the users it
+// mentions. Hidden messages only go to their author's own connections.
+func (app *application) publishMessage(r *http.Request, message models.Message) {
+	event := WebsocketConnectionMessage{
 		Type:   "new-message",
-		RoomID: input.ThreadId,
+		RoomID: message.ThreadId,
 		Data:   message,
-	})
+	}
 
-	app.writeJSON(w, 200, envelope{"message": message}, nil)
+	app.notifyMessageRoom(message, event)
+	if !message.Hidden() {
+		app.notifyMentions(r, message)
+	}
+}
+
+// notifyMessageRoom sends an event about message to its thread's room, or
+// only to its author's own connections while the message is hidden.
+func (app *application) notifyMessageRoom(message models.Message, event WebsocketConnectionMessage) {
+	if message.Hidden() {
+		app.roomManager.notifyUser(message.UserId, event)
+		return
+	}
+
+	app.roomManager.notifyRoom(message.ThreadId, event)
+}
+
+// canSeeMessage reports whether the requesting user may see message, hidden
+// messages are only visible to their author and moderators.
+func (app *application) canSeeMessage(r *http.Request, message models.Message) bool {
+	if !message.Hidden() || app.isAdmin(r) {
+		return true
+	}
+
+	return app.isAuthenticated(r) && app.getUserFromRequst(r).ID == message.UserId
+}
+
+// canSeeMessageInThread is canSeeMessage for a message fetched on its own,
+// which also has to be hidden when its thread is.
+func (app *application) canSeeMessageInThread(r *http.Request, message models.Message) (bool, error) {
+	if !app.canSeeMessage(r, message) {
+		return false, nil
+	}
+
+	thread, err := app.threadModel.GetByIdIncludingDeleted(message.ThreadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return app.canSeeThread(r, thread), nil
 }
 
 func (app *application) deleteMessageHandler(w http.ResponseWriter, r *http.Request) {
@@ -80,7 +218,7 @@ func (app *application) deleteMessageHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.deleteMessage(message)
+	err = app.deleteMessage(message, user.ID)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err, "delete message")
@@ -90,48 +228,112 @@ func (app *application) deleteMessageHandler(w http.ResponseWriter, r *http.Requ
 	app.writeJSON(w, 200, envelope{"message": "message deleted"}, nil)
 }
 
+const (
+	DefaultMessagePageSize = 50
+	MaxMessagePageSize     = 100
+)
+
+// getMessagesHandler pages through a thread newest first. Without a cursor
+// it starts at the newest message, and around=<id> jumps to a message with
+// the ones posted before and after it.
 func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
-	threadId, err := strconv.Atoi(r.URL.Query().Get("threadId"))
+	qs := r.URL.Query()
+
+	threadId, err := strconv.Atoi(qs.Get("threadId"))
 	if err != nil {
 		app.badRequestResponse(w, r, fmt.Errorf("theadId must be a valid number"))
 		return
 	}
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
-	if err != nil {
-		app.badRequestResponse(w, r, fmt.Errorf("limit must be a valid number"))
+
+	limit, err := app.readInt(qs, "limit", DefaultMessagePageSize)
+	if err != nil || limit < 1 || limit > MaxMessagePageSize {
+		app.badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and %d", MaxMessagePageSize))
 		return
 	}
-	messageId, err := strconv.Atoi(r.URL.Query().Get("messageId"))
 
+	cursor, err := app.readCursor(qs)
 	if err != nil {
-		messages, err := app.messageModel.GetByThreadID(threadId, limit)
-		if err != nil {
-			app.serverErrorResponse(w, r, err, "get messages for thread id")
-			return
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Older clients page with messageId and direction, and expect the
+	// messages after messageId oldest first like they used to come
+	legacyAfter := false
+	if messageId, err := strconv.Atoi(qs.Get("messageId")); err == nil && cursor == nil {
+		if qs.Get("direction") == "after" {
+			cursor = &models.Cursor{After: messageId}
+			legacyAfter = true
+		} else {
+			cursor = &models.Cursor{Before: messageId}
 		}
+	}
 
-		app.writeJSON(w, 200, envelope{"messages": messages}, nil)
-		return
+	// Watchers can ask for the read marker to follow what they fetched
+	markRead := qs.Get("markRead") == "true"
+
+	// Marks the viewer's own reactions
+	viewerId := 0
+	if app.isAuthenticated(r) {
+		viewerId = app.getUserFromRequst(r).ID
 	}
 
-	direction := r.URL.Query().Get("direction")
+	// Messages of a deleted thread are only left for moderators
+	if !app.isAdmin(r) {
+		thread, err := app.threadModel.GetById(threadId)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverErrorResponse(w, r, err, "fetching thread")
+			return
+		}
+
+		if err != nil || !app.canSeeThread(r, thread) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+	}
 
 	var messages []models.Message
-	if direction == "after" {
-		messages, err = app.messageModel.GetAfterID(threadId, messageId, limit)
+	var page models.Page
+
+	if qs.Has("around") {
+		aroundId, err := strconv.Atoi(qs.Get("around"))
 		if err != nil {
-			app.serverErrorResponse(w, r, err, "get messages before thread id")
+			app.badRequestResponse(w, r, fmt.Errorf("around must be a valid message id"))
 			return
 		}
-	} else {
-		messages, err = app.messageModel.GetBeforeID(threadId, messageId, limit)
-		if err != nil {
-			app.serverErrorResponse(w, r, err, "get messages before thread id")
+
+		target, err := app.messageModel.GetByIDIncludingDeleted(aroundId)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverErrorResponse(w, r, err, "fetching message")
 			return
 		}
+
+		if err != nil || target.ThreadId != threadId || !app.canSeeMessage(r, target) {
+			app.notFoundResponse(w, r, fmt.Errorf("message not found"))
+			return
+		}
+
+		messages, page, err = app.messageModel.GetAround(threadId, aroundId, limit, viewerId)
+	} else {
+		messages, page, err = app.messageModel.GetPage(threadId, cursor, limit, viewerId)
 	}
 
-	app.writeJSON(w, 200, envelope{"messages": messages}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "get messages for thread id")
+		return
+	}
+
+	if markRead {
+		app.markMessagesRead(r, threadId, messages)
+	}
+
+	app.redactMessages(r, messages)
+
+	if legacyAfter {
+		slices.Reverse(messages)
+	}
+
+	app.writeJSON(w, 200, envelope{"messages": messages, "next": page.Next, "prev": page.Prev, "has_more": page.HasMore}, nil)
 }
 
 func (app *application) queryMessagesHandler(w http.ResponseWriter, r *http.Request) {
@@ -167,10 +369,17 @@ func (app *application) queryMessagesHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Create the query struct
+	cursor, err := app.readCursor(r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	query := models.MessageQuery{
 		Search:    search,
 		PageSize:  pageSize,
 		PageIndex: pageIndex,
+		Cursor:    cursor,
 	}
 
 	// Execute the query
@@ -194,6 +403,53 @@ func (app *application) getMessageByIdHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	message, err := app.messageModel.GetByIDIncludingDeleted(messageId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("message not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "fetching message")
+		return
+	}
+
+	visible, err := app.canSeeMessageInThread(r, message)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	if !visible {
+		app.notFoundResponse(w, r, fmt.Errorf("message not found"))
+		return
+	}
+
+	if !app.isAdmin(r) {
+		message.Redact()
+	}
+
+	app.writeJSON(w, 200, envelope{"message": message}, nil)
+}
+
+func (app *application) updateMessageHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	messageId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Text string `json:"text"`
+	}
+
+	err = app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	message, err := app.messageModel.GetByID(messageId)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
@@ -204,26 +460,212 @@ func (app *application) getMessageByIdHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if message.UserId != user.ID {
+		app.badRequestResponse(w, r, fmt.Errorf("you do not own this message naughty boy"))
+		return
+	}
+
+	// A message can be emptied as long as its image is left
+	if len(input.Text) == 0 && (message.IsFirst || message.Image == "") {
+		app.badRequestResponse(w, r, fmt.Errorf("message is empty"))
+		return
+	}
+
+	if window := app.config.messageEditWindow; time.Since(message.CreatedAt) > window {
+		app.forbiddenResponse(w, r, fmt.Errorf("messages can only be edited within %s of posting", window))
+		return
+	}
+
+	thread, err := app.threadModel.GetById(message.ThreadId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	if thread.Locked {
+		app.forbiddenResponse(w, r, models.ErrThreadLocked)
+		return
+	}
+
+	target := models.FilterTargetMessage
+	if message.IsFirst {
+		target = models.FilterTargetThread
+	}
+
+	text, ok := app.filterEdit(w, r, input.Text, user.ID, target)
+	if !ok {
+		return
+	}
+	input.Text = text
+
+	if message.IsFirst {
+		thread, err = app.threadModel.Update(thread.ID, input.Text, user.ID)
+		if err == nil {
+			app.roomManager.notifyRoom(thread.ID, WebsocketConnectionMessage{
+				Type:   "edit-thread",
+				RoomID: thread.ID,
+				Data:   thread,
+			})
+			message, err = app.messageModel.GetByID(messageId)
+		}
+	} else {
+		message, err = app.messageModel.Update(messageId, input.Text, user.ID)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTextTooLong):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, models.ErrNoRecord):
+			app.notFoundResponse(w, r, fmt.Errorf("message not found"))
+		default:
+			app.serverErrorResponse(w, r, err, "update message")
+		}
+		return
+	}
+
+	app.notifyMessageRoom(message, WebsocketConnectionMessage{
+		Type:   "edit-message",
+		RoomID: message.ThreadId,
+		Data:   message,
+	})
+	app.unfurlMessage(message)
+
 	app.writeJSON(w, 200, envelope{"message": message}, nil)
 }
 
-func (app *application) deleteMessage(message models.Message) error {
+func (app *application) getMessageRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	messageId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Deleted messages keep their history for moderators
+	_, err = app.messageModel.GetByIDIncludingDeleted(messageId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("message not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "fetching message")
+		return
+	}
+
+	revisions, err := app.messageModel.GetRevisions(messageId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching message revisions")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"revisions": revisions}, nil)
+}
+
+// deleteMessage soft deletes a message on behalf of deletedBy, its author or
+// a moderator, and sends its tombstone to the thread's room.
+func (app *application) deleteMessage(message models.Message, deletedBy int) error {
 
 	if message.IsFirst {
-		err := app.deleteThread(message.ThreadId)
+		err := app.deleteThread(message.ThreadId, deletedBy)
 		return err
 	}
 
-	err := app.messageModel.Delete(message.ID)
+	err := app.messageModel.Delete(message.ID, deletedBy)
 
 	if err != nil {
 		return err
 	}
 
-	app.roomManager.notifyRoom(message.ThreadId, WebsocketConnectionMessage{
+	message, err = app.messageModel.GetByIDIncludingDeleted(message.ID)
+	if err != nil {
+		return err
+	}
+	message.Redact()
+
+	app.notifyMessageRoom(message, WebsocketConnectionMessage{
 		Type:   "delete-message",
 		RoomID: message.ThreadId,
 		Data:   message,
 	})
 	return nil
 }
+
+// redactMessages replaces deleted messages with their tombstones for
+// everyone but moderators.
+func (app *application) redactMessages(r *http.Request, messages []models.Message) {
+	if app.isAdmin(r) {
+		return
+	}
+
+	for i := range messages {
+		messages[i].Redact()
+	}
+}
+
+func (app *application) getHeldMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	messages, err := app.messageModel.GetHeldForReview()
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching held messages")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"messages": messages}, nil)
+}
+
+// reviewMessageHandler publishes a message held by a content filter, or
+// deletes it when it's rejected.
+func (app *application) reviewMessageHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	messageId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Approved bool `json:"approved"`
+	}
+
+	err = app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	message, err := app.messageModel.GetByID(messageId)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverErrorResponse(w, r, err, "fetching message")
+		return
+	}
+
+	if err != nil || !message.HeldForReview {
+		app.notFoundResponse(w, r, fmt.Errorf("held message not found"))
+		return
+	}
+
+	if !input.Approved {
+		err = app.messageModel.Delete(messageId, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err, "reject message")
+			return
+		}
+
+		app.writeJSON(w, 200, envelope{"message": "message rejected"}, nil)
+		return
+	}
+
+	message, err = app.messageModel.Approve(messageId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("held message not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "approve message")
+		return
+	}
+
+	app.publishMessage(r, message)
+
+	app.writeJSON(w, 200, envelope{"message": message}, nil)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"globechat.live/internal/filter"
+	"globechat.live/internal/models"
+)
+
+// slowModeDB serves a thread owned by user 1 with a one minute slow mode,
+// in which everyone last posted ten seconds ago by the database's clock.
+func slowModeDB(t *testing.T) *sql.DB {
+	return openFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT threads.id, threads.lat"):
+			return fakeThread{slowModeSeconds: 60}.result()
+		case strings.HasPrefix(query, "SELECT GREATEST(0, EXTRACT(EPOCH FROM"):
+			cooldown := args[2].(float64)
+			return fakeResult{columns: []string{"remaining"}, rows: [][]driver.Value{{cooldown - 10}}}
+		}
+		return fakeResult{}
+	})
+}
+
+func TestCreateMessageWaitsForSlowMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *models.User
+		limited bool
+	}{
+		{"participant", &models.User{ID: 3}, true},
+		{"owner", &models.User{ID: 1}, false},
+		{"moderator", &models.User{ID: 2, IsAdmin: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := slowModeDB(t)
+			app := &application{
+				logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				threadModel:  models.ThreadModel{DB: db},
+				messageModel: models.MessageModel{DB: db},
+				pollModel:    models.PollModel{DB: db},
+				zoneModel:    models.ZoneModel{DB: db},
+				filters:      &filterCache{chain: filter.NewChain()},
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/messages", strings.NewReader(`{"thread_id": 7, "text": "hi"}`))
+			r = r.WithContext(context.WithValue(r.Context(), UserContextKey, tt.user))
+
+			w := httptest.NewRecorder()
+			app.createMessageHandler(w, r)
+
+			if limited := w.Code == http.StatusTooManyRequests; limited != tt.limited {
+				t.Fatalf("got status %d: %s", w.Code, w.Body)
+			}
+
+			if tt.limited && w.Header().Get("Retry-After") != "50" {
+				t.Errorf("got Retry-After %q, want 50", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+// threadMessagesDB serves a visible thread with messages 1 to 20, in the
+// order the statement asks for.
+func threadMessagesDB(t *testing.T) *sql.DB {
+	now := time.Now()
+
+	return openFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT threads.id, threads.lat"):
+			return fakeThread{}.result()
+		case strings.HasPrefix(query, "SELECT messages.id, messages.text"):
+			ids := make([]int64, 0, 20)
+			for id := int64(1); id <= 20; id++ {
+				ids = append(ids, id)
+			}
+			if !strings.Contains(query, "ASC") {
+				slices.Reverse(ids)
+			}
+
+			// Only the keyset condition has a fourth argument
+			var rows [][]driver.Value
+			for _, id := range ids {
+				if len(args) == 4 {
+					if pivot := args[3].(int64); strings.Contains(query, ">") && id <= pivot || strings.Contains(query, "<") && id >= pivot {
+						continue
+					}
+				}
+				if len(rows) == int(args[1].(int64)) {
+					break
+				}
+				rows = append(rows, []driver.Value{
+					id, "hi", "", "", int64(7), false,
+					int64(1), now, "owner", "", nil,
+					nil, []byte("[]"), nil, nil,
+					false, false,
+				})
+			}
+			return fakeResult{columns: make([]string, 17), rows: rows}
+		}
+		return fakeResult{}
+	})
+}
+
+func TestGetMessagesOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{"newest first", "threadId=7&limit=3", []int{20, 19, 18}},
+		{"before a cursor", "threadId=7&limit=3&cursor=" + models.Cursor{Before: 10}.Encode(), []int{9, 8, 7}},
+		{"after a cursor", "threadId=7&limit=3&cursor=" + models.Cursor{After: 10}.Encode(), []int{13, 12, 11}},
+		{"legacy before", "threadId=7&limit=3&messageId=10", []int{9, 8, 7}},
+		{"legacy after stays oldest first", "threadId=7&limit=3&messageId=10&direction=after", []int{11, 12, 13}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := threadMessagesDB(t)
+			app := &application{
+				logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				threadModel:  models.ThreadModel{DB: db},
+				messageModel: models.MessageModel{DB: db},
+				eventModel:   models.EventModel{DB: db},
+				pollModel:    models.PollModel{DB: db},
+				watchModel:   models.WatchModel{DB: db},
+			}
+
+			w := httptest.NewRecorder()
+			app.getMessagesHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/messages?"+tt.query, nil))
+
+			var body struct {
+				Messages []models.Message `json:"messages"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("status %d: %v: %s", w.Code, err, w.Body)
+			}
+
+			var got []int
+			for _, m := range body.Messages {
+				got = append(got, m.ID)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageRevisionsOfMissingMessageIsNotFound(t *testing.T) {
+	tests := []struct {
+		name   string
+		exists bool
+		status int
+	}{
+		{"missing", false, http.StatusNotFound},
+		{"existing", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openFakeDB(t, func(query string, args []driver.Value) fakeResult {
+				if tt.exists && strings.HasPrefix(query, "SELECT messages.id, messages.text") {
+					return fakeResult{columns: make([]string, 17), rows: [][]driver.Value{{
+						int64(3), "hi", "", "", int64(7), false,
+						int64(1), time.Now(), "owner", "", nil,
+						nil, []byte("[]"), nil, nil,
+						false, false,
+					}}}
+				}
+				return fakeResult{}
+			})
+			app := &application{
+				logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				messageModel: models.MessageModel{DB: db},
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/messages/3/revisions", nil)
+			ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "3"}})
+
+			w := httptest.NewRecorder()
+			app.getMessageRevisionsHandler(w, r.WithContext(ctx))
+
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
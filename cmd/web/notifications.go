@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"globechat.live/internal/models"
+)
+
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	limit, err := app.readInt(r.URL.Query(), "limit", 50)
+	if err != nil || limit < 1 || limit > 100 {
+		app.badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and 100"))
+		return
+	}
+
+	notifications, err := app.notificationModel.GetByUserId(user.ID, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching notifications")
+		return
+	}
+
+	unread, err := app.notificationModel.CountUnread(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "counting unread notifications")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"notifications": notifications, "unread": unread}, nil)
+}
+
+func (app *application) readNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	var input struct {
+		// Empty marks every notification as read
+		Ids []int `json:"ids"`
+	}
+
+	err := app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.notificationModel.MarkRead(user.ID, input.Ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "mark notifications read")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"message": "notifications marked as read"}, nil)
+}
+
+// notifyMentions sends a mention event to every online user the message
+// notified.
+func (app *application) notifyMentions(r *http.Request, message models.Message) {
+	if len(message.Mentions) == 0 {
+		return
+	}
+
+	notifications, err := app.notificationModel.GetForMessage(message.ID)
+	if err != nil {
+		app.logError(r, err, "fetching mention notifications")
+		return
+	}
+
+	for _, notification := range notifications {
+		app.roomManager.notifyUser(notification.UserId, WebsocketConnectionMessage{
+			Type:   "mention",
+			RoomID: message.ThreadId,
+			Data: envelope{
+				"notification": notification,
+				"message":      message,
+			},
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"globechat.live/internal/models"
+)
+
+const (
+	MinPollOptions    = 2
+	MaxPollOptions    = 10
+	MaxPollOptionLen  = 100
+	MaxPollOpenPeriod = 365 * 24 * time.Hour
+)
+
+type pollInput struct {
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	ClosesAt       *time.Time `json:"closes_at"`
+}
+
+// validate trims the options and checks the poll can be created now.
+func (input *pollInput) validate(now time.Time) error {
+	input.Question = strings.TrimSpace(input.Question)
+	if len(input.Question) > 280 {
+		return fmt.Errorf("poll question is too long")
+	}
+
+	if len(input.Options) < MinPollOptions || len(input.Options) > MaxPollOptions {
+		return fmt.Errorf("poll must have between %d and %d options", MinPollOptions, MaxPollOptions)
+	}
+
+	seen := make(map[string]bool, len(input.Options))
+	for i, option := range input.Options {
+		option = strings.TrimSpace(option)
+		switch {
+		case option == "":
+			return fmt.Errorf("poll options can't be empty")
+		case len(option) > MaxPollOptionLen:
+			return fmt.Errorf("poll options can't be longer than %d characters", MaxPollOptionLen)
+		case seen[strings.ToLower(option)]:
+			return fmt.Errorf("poll options must be unique")
+		}
+		seen[strings.ToLower(option)] = true
+		input.Options[i] = option
+	}
+
+	if input.ClosesAt != nil {
+		if !input.ClosesAt.After(now) {
+			return fmt.Errorf("poll must close in the future")
+		}
+		if input.ClosesAt.Sub(now) > MaxPollOpenPeriod {
+			return fmt.Errorf("poll can't stay open for more than a year")
+		}
+	}
+
+	return nil
+}
+
+// createPoll stores the poll for a thread, or for one of its messages when
+// messageId isn't nil.
+func (app *application) createPoll(input *pollInput, threadId int, messageId *int) (models.Poll, error) {
+	poll := models.Poll{
+		ThreadId:       threadId,
+		MessageId:      messageId,
+		Question:       input.Question,
+		MultipleChoice: input.MultipleChoice,
+		ClosesAt:       input.ClosesAt,
+	}
+
+	return app.pollModel.Create(poll, input.Options)
+}
+
+func (app *application) getPollHandler(w http.ResponseWriter, r *http.Request) {
+	poll, _, ok := app.readPoll(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"poll": poll}, nil)
+}
+
+func (app *application) votePollHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	poll, thread, ok := app.readPoll(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		OptionIds []int `json:"option_ids"`
+	}
+
+	err := app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.canVote(w, r, poll, thread) {
+		return
+	}
+
+	err = app.pollModel.Vote(poll.ID, user.ID, input.OptionIds)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrPollClosed):
+			app.forbiddenResponse(w, r, err)
+		case errors.Is(err, models.ErrInvalidVote):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err, "vote in poll")
+		}
+		return
+	}
+
+	app.notifyPollUpdate(w, r, poll.ID)
+}
+
+func (app *application) removeVoteHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	poll, thread, ok := app.readPoll(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.canVote(w, r, poll, thread) {
+		return
+	}
+
+	err := app.pollModel.RemoveVote(poll.ID, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("you haven't voted in this poll"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "remove poll vote")
+		return
+	}
+
+	app.notifyPollUpdate(w, r, poll.ID)
+}
+
+// readPoll loads the poll in the :id parameter and its thread, writing the
+// error response itself when it doesn't exist. Polls in deleted threads or
+// messages, or in ones the user can't see, don't exist either.
+func (app *application) readPoll(w http.ResponseWriter, r *http.Request) (models.Poll, models.Thread, bool) {
+	pollId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return models.Poll{}, models.Thread{}, false
+	}
+
+	poll, err := app.pollModel.GetById(pollId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("poll not found"))
+			return models.Poll{}, models.Thread{}, false
+		}
+		app.serverErrorResponse(w, r, err, "fetching poll")
+		return models.Poll{}, models.Thread{}, false
+	}
+
+	visible, thread, err := app.canSeePoll(r, poll)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching poll thread")
+		return models.Poll{}, models.Thread{}, false
+	}
+
+	if !visible {
+		app.notFoundResponse(w, r, fmt.Errorf("poll not found"))
+		return models.Poll{}, models.Thread{}, false
+	}
+
+	return poll, thread, true
+}
+
+// canSeePoll reports whether the requesting user may see poll, which needs
+// its thread and message to be visible and not deleted. It also returns the
+// thread.
+func (app *application) canSeePoll(r *http.Request, poll models.Poll) (bool, models.Thread, error) {
+	thread, err := app.threadModel.GetByIdIncludingDeleted(poll.ThreadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return false, models.Thread{}, nil
+		}
+		return false, models.Thread{}, err
+	}
+
+	if thread.Deleted != nil || !app.canSeeThread(r, thread) {
+		return false, thread, nil
+	}
+
+	if poll.MessageId != nil {
+		message, err := app.messageModel.GetByIDIncludingDeleted(*poll.MessageId)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				return false, thread, nil
+			}
+			return false, thread, err
+		}
+
+		if message.Deleted != nil || !app.canSeeMessage(r, message) {
+			return false, thread, nil
+		}
+	}
+
+	return true, thread, nil
+}
+
+// canVote rejects votes on closed polls and polls in locked threads.
+func (app *application) canVote(w http.ResponseWriter, r *http.Request, poll models.Poll, thread models.Thread) bool {
+	if poll.Closed {
+		app.forbiddenResponse(w, r, models.ErrPollClosed)
+		return false
+	}
+
+	if thread.Locked {
+		app.forbiddenResponse(w, r, models.ErrThreadLocked)
+		return false
+	}
+
+	return true
+}
+
+// notifyPollUpdate sends the new tallies to the poll's thread room and as
+// the response.
+func (app *application) notifyPollUpdate(w http.ResponseWriter, r *http.Request, pollId int) {
+	poll, err := app.pollModel.GetById(pollId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching poll")
+		return
+	}
+
+	app.roomManager.notifyRoom(poll.ThreadId, WebsocketConnectionMessage{
+		Type:   "poll-update",
+		RoomID: poll.ThreadId,
+		Data:   poll,
+	})
+
+	app.writeJSON(w, 200, envelope{"poll": poll}, nil)
+}
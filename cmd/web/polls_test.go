@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"globechat.live/internal/models"
+)
+
+func TestPollsFollowTheirThread(t *testing.T) {
+	tests := []struct {
+		name   string
+		thread fakeThread
+		user   *models.User
+		status int
+	}{
+		{"visible thread", fakeThread{}, &models.User{ID: 3}, http.StatusOK},
+		{"held thread", fakeThread{held: true}, &models.User{ID: 3}, http.StatusNotFound},
+		{"held thread for its owner", fakeThread{held: true}, &models.User{ID: 1}, http.StatusOK},
+		{"deleted thread", fakeThread{deletedAt: time.Now()}, &models.User{ID: 3}, http.StatusNotFound},
+		{"deleted thread for a moderator", fakeThread{deletedAt: time.Now()}, &models.User{ID: 2, IsAdmin: true}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openFakeDB(t, func(query string, args []driver.Value) fakeResult {
+				switch {
+				case strings.HasPrefix(query, "SELECT threads.id, threads.lat"):
+					return tt.thread.result()
+				case strings.HasPrefix(query, "SELECT id, thread_id, message_id, question"):
+					return fakeResult{columns: make([]string, 7), rows: [][]driver.Value{{
+						int64(5), int64(7), nil, "Where next?", false, nil, int64(0),
+					}}}
+				}
+				return fakeResult{}
+			})
+
+			app := &application{
+				logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				threadModel:  models.ThreadModel{DB: db},
+				messageModel: models.MessageModel{DB: db},
+				pollModel:    models.PollModel{DB: db},
+			}
+
+			handlers := map[string]http.HandlerFunc{
+				http.MethodGet:    app.getPollHandler,
+				http.MethodDelete: app.removeVoteHandler,
+			}
+
+			for method, handler := range handlers {
+				r := httptest.NewRequest(method, "/api/v1/polls/5", nil)
+				ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "5"}})
+				ctx = context.WithValue(ctx, UserContextKey, tt.user)
+
+				w := httptest.NewRecorder()
+				handler(w, r.WithContext(ctx))
+
+				if w.Code != tt.status {
+					t.Errorf("%s: got status %d, want %d: %s", method, w.Code, tt.status, w.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"globechat.live/internal/models"
+	"globechat.live/internal/unfurl"
+)
+
+const (
+	// MaxConcurrentUnfurls is how many messages have their links fetched at
+	// the same time
+	MaxConcurrentUnfurls = 8
+	// MaxQueuedUnfurls is how many messages can wait for a free worker, more
+	// than that go without previews
+	MaxQueuedUnfurls = 256
+)
+
+type unfurlJob struct {
+	message models.Message
+	urls    []string
+}
+
+// startUnfurlWorkers starts the fixed pool of workers fetching previews off
+// the queue.
+func (app *application) startUnfurlWorkers() {
+	for range MaxConcurrentUnfurls {
+		go func() {
+			for job := range app.unfurlQueue {
+				if err := app.fetchPreviews(job.message, job.urls); err != nil {
+					app.logger.Error(err.Error(), "action", "unfurl message", "message_id", job.message.ID)
+				}
+			}
+		}()
+	}
+}
+
+// unfurlMessage records the links in a message and queues fetching their
+// previews in the background, they are then pushed to the thread room.
+// When the queue is full the message is skipped rather than piling up work.
+func (app *application) unfurlMessage(message models.Message) {
+	urls := unfurl.ExtractURLs(message.Text)
+
+	// Edits can remove links, so the list is replaced even when empty
+	if len(urls) == 0 && len(message.Previews) == 0 {
+		return
+	}
+
+	select {
+	case app.unfurlQueue <- unfurlJob{message: message, urls: urls}:
+	default:
+		app.logger.Warn("link preview queue is full, skipping message", "message_id", message.ID)
+	}
+}
+
+func (app *application) fetchPreviews(message models.Message, urls []string) error {
+	err := app.previewModel.SetLinks(message.ID, urls)
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().Add(-app.config.unfurlCacheTTL)
+	for _, url := range urls {
+		_, _, err := app.previewModel.GetCached(url, since)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, models.ErrNoRecord) {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.unfurlTimeout)
+		preview, fetchErr := app.unfurler.Fetch(ctx, url)
+		cancel()
+
+		// Failures are cached as well so broken links aren't refetched for
+		// every message that repeats them
+		err = app.previewModel.Save(url, models.LinkPreview{
+			URL:         preview.URL,
+			Title:       preview.Title,
+			Description: preview.Description,
+			Image:       preview.Image,
+			SiteName:    preview.SiteName,
+		}, fetchErr != nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	previews, err := app.previewModel.GetForMessage(message.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(previews) == 0 && len(message.Previews) == 0 {
+		return nil
+	}
+
+	app.notifyMessageRoom(message, WebsocketConnectionMessage{
+		Type:   "message-preview",
+		RoomID: message.ThreadId,
+		Data: envelope{
+			"message_id": message.ID,
+			"previews":   previews,
+		},
+	})
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"globechat.live/internal/ratelimit"
+)
+
+// Actions with their own rate limit.
+const (
+	actionThreadCreate  = "thread.create"
+	actionMessageCreate = "message.create"
+	actionReportCreate  = "report.create"
+	actionWebsocketJoin = "ws.join"
+	actionUploadCreate  = "upload.create"
+)
+
+var defaultRateLimits = map[string]ratelimit.Policy{
+	actionThreadCreate:  {Requests: 5, Per: time.Hour},
+	actionMessageCreate: {Requests: 5, Per: 5 * time.Second},
+	actionReportCreate:  {Requests: 10, Per: time.Hour},
+	actionWebsocketJoin: {Requests: 10, Per: time.Second},
+	actionUploadCreate:  {Requests: 10, Per: time.Minute},
+}
+
+// rateLimitFlag parses -ratelimit values like "message.create=5/10s" on top
+// of the defaults.
+type rateLimitFlag map[string]ratelimit.Policy
+
+func newRateLimitFlag() rateLimitFlag {
+	return maps.Clone(defaultRateLimits)
+}
+
+func (f rateLimitFlag) String() string {
+	limits := make([]string, 0, len(f))
+	for action, policy := range f {
+		limits = append(limits, action+"="+policy.String())
+	}
+	return strings.Join(limits, ",")
+}
+
+func (f rateLimitFlag) Set(s string) error {
+	action, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("rate limit must look like message.create=5/10s")
+	}
+
+	if _, ok := defaultRateLimits[action]; !ok {
+		return fmt.Errorf("unknown rate limited action %q", action)
+	}
+
+	policy, err := ratelimit.ParsePolicy(value)
+	if err != nil {
+		return err
+	}
+
+	f[action] = policy
+	return nil
+}
+
+// clientIP returns the address the request came from, taken from the
+// configured proxy header when there is one.
+func (app *application) clientIP(r *http.Request) string {
+	if app.config.realIPHeader != "" {
+		// Proxies append to X-Forwarded-For style headers, the last address
+		// is the one our proxy saw
+		if value := r.Header.Get(app.config.realIPHeader); value != "" {
+			addresses := strings.Split(value, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// allowAction checks the rate limit of action for the client's IP address
+// and, when signed in, for the user too, so neither switching accounts nor
+// switching addresses gets around it.
+func (app *application) allowAction(r *http.Request, action string) (time.Duration, bool) {
+	keys := []string{"ip:" + app.clientIP(r)}
+	if app.isAuthenticated(r) {
+		keys = append(keys, fmt.Sprintf("user:%d", app.getUserFromRequst(r).ID))
+	}
+
+	return app.rateLimiter.Allow(action, keys...)
+}
+
+func (app *application) rateLimit(action string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		retryAfter, ok := app.allowAction(r, action)
+		if !ok {
+			app.rateLimitExceededResponse(w, r, retryAfter)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// pruneRateLimits frees the memory of buckets that are full again.
+func (app *application) pruneRateLimits() error {
+	app.rateLimiter.Prune()
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"globechat.live/internal/models"
+	"globechat.live/internal/ratelimit"
+)
+
+func TestRateLimitFlagSet(t *testing.T) {
+	f := newRateLimitFlag()
+
+	if err := f.Set("message.create=1/10s"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Set("report.create=off"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := f[actionMessageCreate]; got != (ratelimit.Policy{Requests: 1, Per: 10 * time.Second}) {
+		t.Errorf("message.create is %s", got)
+	}
+
+	if got := f[actionReportCreate]; got.Requests != 0 {
+		t.Errorf("report.create is %s, want off", got)
+	}
+
+	if got, want := f[actionThreadCreate], defaultRateLimits[actionThreadCreate]; got != want {
+		t.Errorf("thread.create is %s, want the default %s", got, want)
+	}
+
+	for _, s := range []string{"message.create", "message.create=5", "unknown.action=1/1s", "=1/1s", "message.create=0/1s"} {
+		if err := f.Set(s); err == nil {
+			t.Errorf("Set(%q): expected an error", s)
+		}
+	}
+}
+
+func TestAllowActionChecksUserAndIP(t *testing.T) {
+	app := &application{
+		rateLimiter: ratelimit.New(map[string]ratelimit.Policy{actionMessageCreate: {Requests: 1, Per: time.Hour}}),
+	}
+
+	request := func(addr string, user *models.User) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/messages", nil)
+		r.RemoteAddr = addr + ":1234"
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), UserContextKey, user))
+		}
+		return r
+	}
+
+	if _, ok := app.allowAction(request("192.0.2.1", &models.User{ID: 1}), actionMessageCreate); !ok {
+		t.Fatal("first request was limited")
+	}
+
+	tests := []struct {
+		name    string
+		r       *http.Request
+		allowed bool
+	}{
+		{"same user from another address", request("192.0.2.2", &models.User{ID: 1}), false},
+		{"another user from the same address", request("192.0.2.1", &models.User{ID: 2}), false},
+		{"anonymous from the same address", request("192.0.2.1", nil), false},
+		{"another user from another address", request("192.0.2.3", &models.User{ID: 3}), true},
+	}
+
+	for _, tt := range tests {
+		retryAfter, ok := app.allowAction(tt.r, actionMessageCreate)
+		if ok != tt.allowed {
+			t.Errorf("%s: got allowed %v, want %v", tt.name, ok, tt.allowed)
+		}
+
+		if !ok && retryAfter <= 0 {
+			t.Errorf("%s: no Retry-After", tt.name)
+		}
+	}
+}
+
+func TestInvalidThreadsDontUseTheRateLimit(t *testing.T) {
+	app := &application{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		rateLimiter: ratelimit.New(map[string]ratelimit.Policy{actionThreadCreate: {Requests: 1, Per: time.Hour}}),
+	}
+
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/threads", strings.NewReader(`{"lat": 0, "long": 0, "message": ""}`))
+		r.RemoteAddr = "192.0.2.1:1234"
+		return r.WithContext(context.WithValue(r.Context(), UserContextKey, &models.User{ID: 1}))
+	}
+
+	for range 3 {
+		w := httptest.NewRecorder()
+		app.createThreadHandler(w, request())
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+		}
+	}
+
+	if _, ok := app.allowAction(request(), actionThreadCreate); !ok {
+		t.Error("invalid requests used up the rate limit")
+	}
+}
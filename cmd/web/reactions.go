@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"globechat.live/internal/models"
+)
+
+// AllowedReactions is the emoji set users can react with.
+var AllowedReactions = []string{"👍", "👎", "❤️", "😂", "😮", "😢", "😡", "🎉", "🔥", "👀"}
+
+type reactionEvent struct {
+	MessageId int    `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	UserId    int    `json:"user_id"`
+	Count     int    `json:"count"`
+}
+
+func (app *application) addReactionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	var input struct {
+		Emoji string `json:"emoji"`
+	}
+
+	err := app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	message, ok := app.readReactionTarget(w, r, input.Emoji)
+	if !ok {
+		return
+	}
+
+	thread, err := app.threadModel.GetById(message.ThreadId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	if thread.Locked {
+		app.forbiddenResponse(w, r, models.ErrThreadLocked)
+		return
+	}
+
+	added, err := app.reactionModel.Add(message.ID, user.ID, input.Emoji)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "add reaction")
+		return
+	}
+
+	event, err := app.reactionEvent(message, user.ID, input.Emoji)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "count reactions")
+		return
+	}
+
+	if added {
+		app.notifyMessageRoom(message, WebsocketConnectionMessage{
+			Type:   "reaction-add",
+			RoomID: message.ThreadId,
+			Data:   event,
+		})
+	}
+
+	app.writeJSON(w, 200, envelope{"reaction": event}, nil)
+}
+
+func (app *application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	emoji := r.URL.Query().Get("emoji")
+
+	message, ok := app.readReactionTarget(w, r, emoji)
+	if !ok {
+		return
+	}
+
+	err := app.reactionModel.Remove(message.ID, user.ID, emoji)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("you haven't reacted with %s", emoji))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "remove reaction")
+		return
+	}
+
+	event, err := app.reactionEvent(message, user.ID, emoji)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "count reactions")
+		return
+	}
+
+	app.notifyMessageRoom(message, WebsocketConnectionMessage{
+		Type:   "reaction-remove",
+		RoomID: message.ThreadId,
+		Data:   event,
+	})
+
+	app.writeJSON(w, 200, envelope{"reaction": event}, nil)
+}
+
+// readReactionTarget validates emoji and loads the message in the :id
+// parameter, writing the error response itself on failure.
+func (app *application) readReactionTarget(w http.ResponseWriter, r *http.Request, emoji string) (models.Message, bool) {
+	messageId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return models.Message{}, false
+	}
+
+	if !slices.Contains(AllowedReactions, emoji) {
+		app.badRequestResponse(w, r, fmt.Errorf("emoji must be one of %v", AllowedReactions))
+		return models.Message{}, false
+	}
+
+	message, err := app.messageModel.GetByID(messageId)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverErrorResponse(w, r, err, "fetching message")
+		return models.Message{}, false
+	}
+
+	if err != nil {
+		app.notFoundResponse(w, r, fmt.Errorf("message not found"))
+		return models.Message{}, false
+	}
+
+	visible, err := app.canSeeMessageInThread(r, message)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return models.Message{}, false
+	}
+
+	if !visible {
+		app.notFoundResponse(w, r, fmt.Errorf("message not found"))
+		return models.Message{}, false
+	}
+
+	return message, true
+}
+
+func (app *application) reactionEvent(message models.Message, userId int, emoji string) (reactionEvent, error) {
+	count, err := app.reactionModel.Count(message.ID, emoji)
+	if err != nil {
+		return reactionEvent{}, err
+	}
+
+	return reactionEvent{
+		MessageId: message.ID,
+		Emoji:     emoji,
+		UserId:    userId,
+		Count:     count,
+	}, nil
+}
@@ -76,6 +76,8 @@ func (app *application) deleteReportHandler(w http.ResponseWriter, r *http.Reque
 }
 
 func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
 	reportId, err := strconv.Atoi(r.URL.Query().Get("reportId"))
 
 	if err != nil {
@@ -90,18 +92,21 @@ func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	message, err := app.messageModel.GetByID(report.MessageId)
+	message, err := app.messageModel.GetByIDIncludingDeleted(report.MessageId)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err, "get message by id")
 		return
 	}
 
-	err = app.deleteMessage(message)
+	// The author may have deleted it already, the report stays as evidence
+	if message.Deleted == nil {
+		err = app.deleteMessage(message, user.ID)
 
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
 	}
 
 	app.writeJSON(w, 200, envelope{"message": "report deleted"}, nil)
@@ -140,10 +145,17 @@ func (app *application) queryReportsHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Create the query struct
+	cursor, err := app.readCursor(r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	query := models.ReportQuery{
 		Search:    search,
 		PageSize:  pageSize,
 		PageIndex: pageIndex,
+		Cursor:    cursor,
 	}
 
 	// Execute the query
@@ -24,19 +24,72 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/api/v1/randomthread", app.getRandomThread)
 	router.HandlerFunc(http.MethodPost, "/api/v1/threads", app.requireAuthentication(app.createThreadHandler))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/threads", app.requireAuthentication(app.deleteThreadHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/threads/:id", app.requireAuthentication(app.updateThreadHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/threads/:id/revisions", app.requireAdminAccess(app.getThreadRevisionsHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/threads/:id/lock", app.requireAdminAccess(app.lockThreadHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/threads/:id/pin", app.requireAdminAccess(app.pinThreadHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/threads/:id/review", app.requireAdminAccess(app.reviewThreadHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/threads/:id/slow-mode", app.requireAuthentication(app.setSlowModeHandler))
+
+	// Watch list
+	router.HandlerFunc(http.MethodPost, "/api/v1/threads/:id/watch", app.requireAuthentication(app.watchThreadHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/threads/:id/watch", app.requireAuthentication(app.unwatchThreadHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/watching", app.requireAuthentication(app.getWatchingHandler))
+
+	// Events
+	router.HandlerFunc(http.MethodGet, "/api/v1/events", app.getUpcomingEventsHandler)
+	router.HandlerFunc(http.MethodGet, "/api/v1/threads/:id/rsvps", app.getRSVPsHandler)
+	router.HandlerFunc(http.MethodPost, "/api/v1/threads/:id/rsvp", app.requireAuthentication(app.rsvpEventHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/threads/:id/rsvp", app.requireAuthentication(app.cancelRSVPHandler))
+
+	// Polls
+	router.HandlerFunc(http.MethodGet, "/api/v1/polls/:id", app.getPollHandler)
+	router.HandlerFunc(http.MethodPost, "/api/v1/polls/:id/vote", app.requireAuthentication(app.votePollHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/polls/:id/vote", app.requireAuthentication(app.removeVoteHandler))
+
+	// Notifications
+	router.HandlerFunc(http.MethodGet, "/api/v1/notifications", app.requireAuthentication(app.getNotificationsHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/notifications/read", app.requireAuthentication(app.readNotificationsHandler))
+
+	// Map tiles
+	router.HandlerFunc(http.MethodGet, "/api/v1/tiles/:z/:x/:y", app.getTileHandler)
 
 	// Messages
-	router.HandlerFunc(http.MethodPost, "/api/v1/messages", app.requireAuthentication(app.createMessageHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/messages", app.requireAuthentication(app.rateLimit(actionMessageCreate, app.createMessageHandler)))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/messages", app.requireAuthentication(app.deleteMessageHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/messages", app.getMessagesHandler)
 	router.HandlerFunc(http.MethodGet, "/api/v1/messages/:id", app.getMessageByIdHandler)
+	router.HandlerFunc(http.MethodPatch, "/api/v1/messages/:id", app.requireAuthentication(app.updateMessageHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/messages/:id/revisions", app.requireAdminAccess(app.getMessageRevisionsHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/messages/:id/reactions", app.requireAuthentication(app.addReactionHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/messages/:id/reactions", app.requireAuthentication(app.removeReactionHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/messages/:id/review", app.requireAdminAccess(app.reviewMessageHandler))
+
+	// Uploads
+	router.HandlerFunc(http.MethodPost, "/api/v1/uploads", app.requireAuthentication(app.rateLimit(actionUploadCreate, app.uploadImageHandler)))
 
 	// Reports
-	router.HandlerFunc(http.MethodPost, "/api/v1/reports", app.requireAuthentication(app.createReportHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/reports", app.requireAuthentication(app.rateLimit(actionReportCreate, app.createReportHandler)))
 	router.HandlerFunc(http.MethodPatch, "/api/v1/reports/resolve", app.requireAdminAccess(app.resolveReportHandler))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/reports", app.requireAdminAccess(app.deleteReportHandler))
 
+	// Zones
+	router.HandlerFunc(http.MethodGet, "/api/v1/zones", app.requireAdminAccess(app.getZonesHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/zones", app.requireAdminAccess(app.createZoneHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/zones/import", app.requireAdminAccess(app.importZonesHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/zones/:id", app.requireAdminAccess(app.updateZoneHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/zones/:id", app.requireAdminAccess(app.deleteZoneHandler))
+
+	// Content filters
+	router.HandlerFunc(http.MethodGet, "/api/v1/filters", app.requireAdminAccess(app.getFilterRulesHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/filters", app.requireAdminAccess(app.createFilterRuleHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/filters/:id", app.requireAdminAccess(app.updateFilterRuleHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/filters/:id", app.requireAdminAccess(app.deleteFilterRuleHandler))
+
 	// Queries
+	router.HandlerFunc(http.MethodGet, "/api/v1/query/held-threads", app.requireAdminAccess(app.getHeldThreadsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/query/held-messages", app.requireAdminAccess(app.getHeldMessagesHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/query/filter-hits", app.requireAdminAccess(app.getFilterHitsHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/query/reports", app.requireAdminAccess(app.queryReportsHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/query/messages", app.requireAdminAccess(app.queryMessagesHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/query/users", app.requireAdminAccess(app.queryUsersHandler))
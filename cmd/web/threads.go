@@ -4,21 +4,32 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"globechat.live/internal/geo"
 	"globechat.live/internal/models"
 )
 
-const MinDistanceBetweenThreads = 0.05 // in km
+const MaxPlaceDistanceKm = 100 // threads further than this from any known place aren't labelled
+
+const MaxSlowModeSeconds = 6 * 60 * 60
 
 func (app *application) createThreadHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.getUserFromRequst(r)
 
 	var input struct {
-		Lat     float64 `json:"lat"`
-		Long    float64 `json:"long"`
-		Message string  `json:"message"`
+		Lat       float64 `json:"lat"`
+		Long      float64 `json:"long"`
+		Message   string  `json:"message"`
+		Precision string  `json:"precision"`
+		// Optional, makes the thread an event
+		Event *eventInput `json:"event"`
+		// Optional poll attached to the thread
+		Poll *pollInput `json:"poll"`
 	}
 
 	err := app.readJSONFromRequest(w, r, &input)
@@ -32,46 +43,131 @@ func (app *application) createThreadHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	threads, err := app.threadModel.GetByLocationRadius(input.Lat, input.Long, MinDistanceBetweenThreads)
+	if input.Lat < -90 || input.Lat > 90 {
+		app.badRequestResponse(w, r, fmt.Errorf("lat must be between -90 and 90"))
+		return
+	}
+
+	if input.Long < -180 || input.Long > 180 {
+		app.badRequestResponse(w, r, fmt.Errorf("long must be between -180 and 180"))
+		return
+	}
+
+	var event *models.Event
+	if input.Event != nil {
+		e, err := input.Event.toEvent(time.Now())
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		event = &e
+	}
+
+	if input.Poll != nil {
+		if err = input.Poll.validate(time.Now()); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
 
+	precision, err := app.locationPrecisionFor(user, input.Precision)
 	if err != nil {
-		app.serverErrorResponse(w, r, err, "fetching nearby threads which creating one")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if len(threads) > 0 {
-		app.badRequestResponse(w, r, fmt.Errorf("too close to other threads"))
+	// Zones are checked where the user really is as well, snapping could
+	// otherwise move a thread out of a zone near its edge
+	rawRules, err := app.zoneModel.GetRules(input.Lat, input.Long)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching zone rules")
 		return
 	}
 
-	userThreads, err := app.threadModel.GetAllByUserId(user.ID)
+	// Only the fuzzed location is stored or returned
+	input.Lat, input.Long = precision.Snap(input.Lat, input.Long)
+
+	rules, err := app.zoneModel.GetRules(input.Lat, input.Long)
 	if err != nil {
-		app.serverErrorResponse(w, r, err, "getting user threads")
+		app.serverErrorResponse(w, r, err, "fetching zone rules")
+		return
+	}
+	rules = rules.Merge(rawRules)
+
+	if rules.NoNewThreads || rules.ReadOnly {
+		app.forbiddenResponse(w, r, fmt.Errorf("new threads are not allowed in %s", zoneNames(rules.Zones)))
+		return
+	}
+
+	// Checked only now so a request that was never going to create a thread
+	// doesn't use up one of the few allowed per hour
+	if retryAfter, ok := app.allowAction(r, actionThreadCreate); !ok {
+		app.rateLimitExceededResponse(w, r, retryAfter)
 		return
 	}
 
-	if len(userThreads) >= 10 {
-		app.badRequestResponse(w, r, fmt.Errorf("too many threads"))
+	limits := models.ThreadLimits{
+		MinSpacingKm: app.config.threadSpacingKm,
+		MaxPerUser:   app.config.threadLimit,
+		Rules:        rules,
+	}
+
+	text, visibility, ok := app.filterText(w, r, input.Message, user.ID, models.FilterTargetThread)
+	if !ok {
 		return
 	}
 
-	thread, err := app.threadModel.Create(input.Message, input.Lat, input.Long, user.ID)
+	thread, err := app.threadModel.Create(text, input.Lat, input.Long, app.nearestPlace(input.Lat, input.Long), user.ID, limits, visibility)
 	if err != nil {
-		if errors.Is(err, models.ErrTextTooLong) {
+		var limitErr *models.ThreadLimitError
+		switch {
+		case errors.As(err, &limitErr):
+			app.writeJSON(w, http.StatusBadRequest, envelope{"error": limitErr.Error(), "limit": limitErr}, nil)
+		case errors.Is(err, models.ErrTextTooLong):
 			app.badRequestResponse(w, r, err)
-			return
+		default:
+			app.serverErrorResponse(w, r, err, "create thread")
 		}
-		app.serverErrorResponse(w, r, err, "create thread")
 		return
 	}
-	_, err = app.messageModel.Create(input.Message, "", thread.ID, user.ID, true)
+	// A held thread's first message stays public like with zone reviews, the
+	// thread hides it, but a shadowed thread must never notify anyone
+	firstVisibility := models.VisibilityPublic
+	if visibility == models.VisibilityShadow {
+		firstVisibility = models.VisibilityShadow
+	}
+
+	first, err := app.messageModel.Create(text, nil, thread.ID, user.ID, true, nil, firstVisibility, 0)
 	if err != nil {
 		app.serverErrorResponse(w, r, err, "create message")
-		app.threadModel.Delete(thread.ID)
+		app.threadModel.Purge(thread.ID)
 		return
 	}
 
-	app.writeJSON(w, 200, envelope{"thread": (thread)}, nil)
+	if input.Poll != nil {
+		poll, err := app.createPoll(input.Poll, thread.ID, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err, "create poll")
+			app.threadModel.Purge(thread.ID)
+			return
+		}
+		thread.Poll = &poll
+	}
+
+	if event != nil {
+		event.ThreadId = thread.ID
+		*event, err = app.eventModel.Create(*event)
+		if err != nil {
+			app.serverErrorResponse(w, r, err, "create event")
+			app.threadModel.Purge(thread.ID)
+			return
+		}
+	}
+
+	app.notifyMentions(r, first)
+	app.unfurlMessage(first)
+
+	app.writeJSON(w, 200, envelope{"thread": (thread), "event": event}, nil)
 }
 
 func (app *application) getThreadsHandler(w http.ResponseWriter, r *http.Request) {
@@ -92,35 +188,24 @@ func (app *application) getThreadsHandler(w http.ResponseWriter, r *http.Request
 		app.writeJSON(w, 200, envelope{"threads": threads}, nil)
 		return
 	}
-	minLat, err := strconv.ParseFloat(r.URL.Query().Get("minLat"), 64)
-	if err != nil {
-		app.badRequestResponse(w, r, fmt.Errorf("send valid minLat"))
-		return
-	}
-
-	maxLat, err := strconv.ParseFloat(r.URL.Query().Get("maxLat"), 64)
+	boxes, err := app.readBounds(r.URL.Query())
 	if err != nil {
-		app.badRequestResponse(w, r, fmt.Errorf("send valid maxLat"))
-		return
-	}
-
-	minLong, err := strconv.ParseFloat(r.URL.Query().Get("minLong"), 64)
-	if err != nil {
-		app.badRequestResponse(w, r, fmt.Errorf("send valid minLong"))
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	maxLong, err := strconv.ParseFloat(r.URL.Query().Get("maxLong"), 64)
+	countryCode, err := app.readCountryCode(r.URL.Query())
 	if err != nil {
-		app.badRequestResponse(w, r, fmt.Errorf("send valid maxLong"))
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	threads, err := app.threadModel.GetByBounds(minLat, minLong, maxLat, maxLong, 500)
+	threads, err := app.threadModel.GetByBounds(boxes, countryCode, 500)
 
 	if err != nil {
 		if errors.Is(err, models.ErrTooManyItems) {
-			app.badRequestResponse(w, r, err)
+			// Pinned threads are shown whatever the zoom level
+			app.writeJSON(w, 200, envelope{"threads": threads, "too_many": true}, nil)
 			return
 		}
 		app.serverErrorResponse(w, r, err, "fetching threads")
@@ -134,12 +219,78 @@ func (app *application) getThreadByIDHandler(w http.ResponseWriter, r *http.Requ
 	params := httprouter.ParamsFromContext(r.Context())
 	id := params.ByName("id")
 
+	// httprouter doesn't allow a static segment next to the :id wildcard,
+	// so /api/v1/threads/trending is dispatched from here
+	if id == "trending" {
+		app.getTrendingThreadsHandler(w, r)
+		return
+	}
+
 	threadId, err := strconv.Atoi(id)
 	if err != nil {
 		app.badRequestResponse(w, r, fmt.Errorf("id must be a valid number"))
 		return
 	}
 
+	// Deleted threads come back as tombstones, moderators still see what
+	// they said
+	thread, err := app.threadModel.GetByIdIncludingDeleted(threadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	if !app.canSeeThread(r, thread) {
+		app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+		return
+	}
+
+	if !app.isAdmin(r) {
+		thread.Redact()
+	}
+
+	// Event is null for regular threads
+	var event *models.Event
+	e, err := app.eventModel.GetByThreadId(threadId)
+	switch {
+	case err == nil:
+		event = &e
+	case !errors.Is(err, models.ErrNoRecord):
+		app.serverErrorResponse(w, r, err, "fetching event")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"thread": thread, "event": event}, nil)
+}
+
+func (app *application) updateThreadHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	threadId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Message string `json:"message"`
+	}
+
+	err = app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(input.Message) == 0 {
+		app.badRequestResponse(w, r, fmt.Errorf("message is empty"))
+		return
+	}
+
 	thread, err := app.threadModel.GetById(threadId)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
@@ -150,14 +301,234 @@ func (app *application) getThreadByIDHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if thread.UserId != user.ID {
+		app.badRequestResponse(w, r, fmt.Errorf("you do not own this thread naughty boy"))
+		return
+	}
+
+	text, ok := app.filterEdit(w, r, input.Message, user.ID, models.FilterTargetThread)
+	if !ok {
+		return
+	}
+
+	thread, err = app.threadModel.Update(threadId, text, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTextTooLong):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, models.ErrNoRecord):
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+		default:
+			app.serverErrorResponse(w, r, err, "update thread")
+		}
+		return
+	}
+
+	app.roomManager.notifyRoom(threadId, WebsocketConnectionMessage{
+		Type:   "edit-thread",
+		RoomID: threadId,
+		Data:   thread,
+	})
+
+	app.writeJSON(w, 200, envelope{"thread": thread}, nil)
+}
+
+func (app *application) getThreadRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	threadId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Deleted threads keep their history for moderators
+	_, err = app.threadModel.GetByIdIncludingDeleted(threadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	revisions, err := app.threadModel.GetRevisions(threadId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching thread revisions")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"revisions": revisions}, nil)
+}
+
+func (app *application) lockThreadHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Locked bool `json:"locked"`
+	}
+
+	app.setThreadFlag(w, r, &input, "lock-thread", func(threadId int) error {
+		return app.threadModel.SetLocked(threadId, input.Locked)
+	})
+}
+
+func (app *application) pinThreadHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Pinned bool `json:"pinned"`
+	}
+
+	app.setThreadFlag(w, r, &input, "pin-thread", func(threadId int) error {
+		return app.threadModel.SetPinned(threadId, input.Pinned)
+	})
+}
+
+// setThreadFlag reads input, applies a moderation change to the thread in
+// the :id parameter and tells everyone in the thread room about it.
+func (app *application) setThreadFlag(w http.ResponseWriter, r *http.Request, input any, event string, update func(threadId int) error) {
+	threadId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.readJSONFromRequest(w, r, input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = update(threadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, event)
+		return
+	}
+
+	thread, err := app.threadModel.GetById(threadId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	app.roomManager.notifyRoom(threadId, WebsocketConnectionMessage{
+		Type:   event,
+		RoomID: threadId,
+		Data:   thread,
+	})
+
 	app.writeJSON(w, 200, envelope{"thread": thread}, nil)
 }
 
+func (app *application) getHeldThreadsHandler(w http.ResponseWriter, r *http.Request) {
+	threads, err := app.threadModel.GetHeldForReview()
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching held threads")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"threads": threads}, nil)
+}
+
+// reviewThreadHandler publishes a thread held by a zone's review rule, or
+// deletes it when it's rejected.
+func (app *application) reviewThreadHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	threadId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Approved bool `json:"approved"`
+	}
+
+	err = app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !input.Approved {
+		err = app.deleteThread(threadId, user.ID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+				return
+			}
+			app.serverErrorResponse(w, r, err, "reject thread")
+			return
+		}
+
+		app.writeJSON(w, 200, envelope{"message": "thread rejected"}, nil)
+		return
+	}
+
+	err = app.threadModel.SetHeldForReview(threadId, false)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "approve thread")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"message": "thread approved"}, nil)
+}
+
 func (app *application) getRandomThread(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
 
-	thread, err := app.threadModel.GetRandomThread()
+	query := models.RandomQuery{Bias: qs.Get("bias")}
+
+	switch query.Bias {
+	case models.RandomBiasNone, models.RandomBiasRecent, models.RandomBiasActive:
+	default:
+		app.badRequestResponse(w, r, fmt.Errorf("bias must be recent or active"))
+		return
+	}
+
+	// Restrict the pick to a region, e.g. one the user hasn't explored yet
+	if qs.Has("minLat") {
+		boxes, err := app.readBounds(qs)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		query.Boxes = boxes
+	}
+
+	if qs.Get("exclude") != "" {
+		ids := strings.Split(qs.Get("exclude"), ",")
+		if len(ids) > 100 {
+			app.badRequestResponse(w, r, fmt.Errorf("exclude can't contain more than 100 ids"))
+			return
+		}
+
+		for _, id := range ids {
+			threadId, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				app.badRequestResponse(w, r, fmt.Errorf("exclude must be a comma separated list of thread ids"))
+				return
+			}
+			query.ExcludeIds = append(query.ExcludeIds, threadId)
+		}
+	}
+
+	if app.isAuthenticated(r) && qs.Get("unseen") == "true" {
+		query.ExcludeUserId = app.getUserFromRequst(r).ID
+	}
+
+	thread, err := app.threadModel.GetRandomThread(query)
 
 	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("no threads found"))
+			return
+		}
 		app.serverErrorResponse(w, r, err, "fetching threads")
 		return
 	}
@@ -190,7 +561,7 @@ func (app *application) deleteThreadHandler(w http.ResponseWriter, r *http.Reque
 		app.badRequestResponse(w, r, fmt.Errorf("you do not own this thread naughty boy"))
 		return
 	}
-	err = app.deleteThread(threadId)
+	err = app.deleteThread(threadId, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err, "delete thread")
 		return
@@ -204,8 +575,97 @@ func (app *application) deleteThreadHandler(w http.ResponseWriter, r *http.Reque
 	app.writeJSON(w, 200, envelope{"message": "thread deleted"}, nil)
 }
 
-func (app *application) deleteThread(threadId int) error {
-	err := app.threadModel.Delete(threadId)
+// canSeeThread reports whether the requesting user may see thread, threads
+// held for review or shadow hidden are only visible to their author and
+// moderators.
+func (app *application) canSeeThread(r *http.Request, thread models.Thread) bool {
+	if !thread.HeldForReview && !thread.ShadowHidden || app.isAdmin(r) {
+		return true
+	}
+
+	return app.isAuthenticated(r) && app.getUserFromRequst(r).ID == thread.UserId
+}
+
+// canManageThread reports whether the requesting user owns thread or is a
+// moderator.
+func (app *application) canManageThread(r *http.Request, thread models.Thread) bool {
+	return app.isAdmin(r) || app.isAuthenticated(r) && app.getUserFromRequst(r).ID == thread.UserId
+}
+
+// slowModeFor returns the cooldown between the requesting user's messages
+// in thread, the owner and moderators never wait.
+func (app *application) slowModeFor(r *http.Request, thread models.Thread) time.Duration {
+	if app.canManageThread(r, thread) {
+		return 0
+	}
+
+	return time.Duration(thread.SlowModeSeconds) * time.Second
+}
+
+// setSlowModeHandler lets the thread owner or a moderator change the slow
+// mode interval, clients in the thread are told with a thread-settings event.
+func (app *application) setSlowModeHandler(w http.ResponseWriter, r *http.Request) {
+	threadId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		// 0 turns slow mode off
+		Seconds int `json:"seconds"`
+	}
+
+	err = app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Seconds < 0 || input.Seconds > MaxSlowModeSeconds {
+		app.badRequestResponse(w, r, fmt.Errorf("seconds must be between 0 and %d", MaxSlowModeSeconds))
+		return
+	}
+
+	thread, err := app.threadModel.GetById(threadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	if !app.canManageThread(r, thread) {
+		app.forbiddenResponse(w, r, fmt.Errorf("only the thread owner or a moderator can change slow mode"))
+		return
+	}
+
+	err = app.threadModel.SetSlowMode(threadId, input.Seconds)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "set slow mode")
+		return
+	}
+	thread.SlowModeSeconds = input.Seconds
+
+	app.roomManager.notifyRoom(threadId, WebsocketConnectionMessage{
+		Type:   "thread-settings",
+		RoomID: threadId,
+		Data:   envelope{"slow_mode_seconds": thread.SlowModeSeconds},
+	})
+
+	app.writeJSON(w, 200, envelope{"thread": thread}, nil)
+}
+
+// deleteThread soft deletes a thread on behalf of deletedBy, its author or
+// a moderator.
+func (app *application) deleteThread(threadId int, deletedBy int) error {
+	err := app.threadModel.Delete(threadId, deletedBy)
 	if err != nil {
 		return err
 	}
@@ -218,3 +678,118 @@ func (app *application) deleteThread(threadId int) error {
 
 	return nil
 }
+
+func (app *application) getTrendingThreadsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	limit, err := app.readInt(qs, "limit", 20)
+	if err != nil || limit < 1 || limit > 100 {
+		app.badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and 100"))
+		return
+	}
+
+	query := models.TrendingQuery{Limit: limit}
+
+	query.CountryCode, err = app.readCountryCode(qs)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	switch {
+	case qs.Has("minLat"):
+		query.Boxes, err = app.readBounds(qs)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	case qs.Has("lat"):
+		query.HasRadius = true
+		query.Lat, err = strconv.ParseFloat(qs.Get("lat"), 64)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("send valid lat"))
+			return
+		}
+		query.Long, err = strconv.ParseFloat(qs.Get("long"), 64)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("send valid long"))
+			return
+		}
+		query.RadiusKm = 25
+		if qs.Has("radius") {
+			query.RadiusKm, err = strconv.ParseFloat(qs.Get("radius"), 64)
+			if err != nil || query.RadiusKm <= 0 {
+				app.badRequestResponse(w, r, fmt.Errorf("radius must be a positive number of km"))
+				return
+			}
+		}
+	}
+
+	threads, err := app.threadModel.GetTrending(query)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching trending threads")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"threads": threads}, nil)
+}
+
+// readBounds parses the minLat/maxLat/minLong/maxLong viewport parameters and
+// splits the viewport into boxes that don't cross the antimeridian.
+func (app *application) readBounds(qs url.Values) ([]geo.BoundingBox, error) {
+	var values [4]float64
+	for i, key := range []string{"minLat", "minLong", "maxLat", "maxLong"} {
+		v, err := strconv.ParseFloat(qs.Get(key), 64)
+		if err != nil {
+			return nil, fmt.Errorf("send valid %s", key)
+		}
+		// Longitudes wrap as the map is panned, latitudes never leave the
+		// poles
+		if (key == "minLat" || key == "maxLat") && (v < -90 || v > 90) {
+			return nil, fmt.Errorf("%s must be between -90 and 90", key)
+		}
+		values[i] = v
+	}
+
+	return geo.SplitBounds(values[0], values[1], values[2], values[3])
+}
+
+// locationPrecisionFor picks the precision a new thread is stored with: the
+// one requested for the thread, then the user's preference, then the server
+// default.
+func (app *application) locationPrecisionFor(user *models.User, requested string) (geo.Precision, error) {
+	if requested != "" {
+		return geo.ParsePrecision(requested)
+	}
+
+	if user.LocationPrecision != "" {
+		return geo.ParsePrecision(user.LocationPrecision)
+	}
+
+	return app.config.locationPrecision, nil
+}
+
+// readCountryCode reads the optional ISO 3166 alpha-2 country filter.
+func (app *application) readCountryCode(qs url.Values) (string, error) {
+	country := strings.ToUpper(strings.TrimSpace(qs.Get("country")))
+	if country == "" {
+		return "", nil
+	}
+
+	if len(country) != 2 || strings.Trim(country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("country must be a two letter country code")
+	}
+
+	return country, nil
+}
+
+// nearestPlace labels a location with the closest known place, or returns
+// an empty place when no cities dataset is loaded or nothing is close.
+func (app *application) nearestPlace(lat, long float64) geo.Place {
+	place, distance, ok := app.geocoder.Nearest(lat, long)
+	if !ok || distance > MaxPlaceDistanceKm {
+		return geo.Place{}
+	}
+
+	return place
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"globechat.live/internal/models"
+)
+
+func TestReadBoundsRejectsInvalidViewports(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name string
+		qs   string
+	}{
+		{"missing parameter", "minLat=0&minLong=0&maxLat=10"},
+		{"not a number", "minLat=abc&minLong=0&maxLat=10&maxLong=10"},
+		{"latitude below the south pole", "minLat=-91&minLong=0&maxLat=10&maxLong=10"},
+		{"latitude above the north pole", "minLat=0&minLong=0&maxLat=90.5&maxLong=10"},
+		{"NaN", "minLat=0&minLong=NaN&maxLat=10&maxLong=10"},
+		{"infinity", "minLat=0&minLong=0&maxLat=10&maxLong=Inf"},
+		{"inverted latitudes", "minLat=20&minLong=0&maxLat=10&maxLong=10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs, err := url.ParseQuery(tt.qs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if boxes, err := app.readBounds(qs); err == nil {
+				t.Errorf("expected an error, got %v", boxes)
+			}
+		})
+	}
+}
+
+func TestReadBoundsWrapsLongitudes(t *testing.T) {
+	app := &application{}
+
+	qs, _ := url.ParseQuery("minLat=-10&minLong=170&maxLat=10&maxLong=190")
+	boxes, err := app.readBounds(qs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(boxes) != 2 || boxes[0].MinLong != 170 || boxes[0].MaxLong != 180 ||
+		boxes[1].MinLong != -180 || boxes[1].MaxLong != -170 {
+		t.Errorf("unexpected boxes %+v", boxes)
+	}
+}
+
+// heldThreadDB serves one thread held for review, owned by user 1.
+func heldThreadDB(t *testing.T) *sql.DB {
+	return openFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if !strings.HasPrefix(query, "SELECT threads.id, threads.lat") {
+			return fakeResult{}
+		}
+
+		return fakeThread{held: true}.result()
+	})
+}
+
+func TestHeldThreadIsHiddenFromThirdParties(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   *models.User
+		status int
+	}{
+		{"anonymous", nil, http.StatusNotFound},
+		{"third party", &models.User{ID: 3}, http.StatusNotFound},
+		{"owner", &models.User{ID: 1}, http.StatusOK},
+		{"moderator", &models.User{ID: 2, IsAdmin: true}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := heldThreadDB(t)
+			app := &application{
+				logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				threadModel:  models.ThreadModel{DB: db},
+				messageModel: models.MessageModel{DB: db},
+				eventModel:   models.EventModel{DB: db},
+				pollModel:    models.PollModel{DB: db},
+				watchModel:   models.WatchModel{DB: db},
+			}
+
+			requests := map[string]*http.Request{
+				"thread":   httptest.NewRequest(http.MethodGet, "/api/v1/threads/7", nil),
+				"messages": httptest.NewRequest(http.MethodGet, "/api/v1/messages?threadId=7", nil),
+			}
+			handlers := map[string]http.HandlerFunc{
+				"thread":   app.getThreadByIDHandler,
+				"messages": app.getMessagesHandler,
+			}
+
+			for endpoint, r := range requests {
+				ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "7"}})
+				if tt.user != nil {
+					ctx = context.WithValue(ctx, UserContextKey, tt.user)
+				}
+
+				w := httptest.NewRecorder()
+				handlers[endpoint](w, r.WithContext(ctx))
+
+				if w.Code != tt.status {
+					t.Errorf("%s: got status %d, want %d: %s", endpoint, w.Code, tt.status, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestWatchingHeldThreadIsNotFound(t *testing.T) {
+	tests := []struct {
+		user   *models.User
+		status int
+	}{
+		{&models.User{ID: 3}, http.StatusNotFound},
+		{&models.User{ID: 1}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		db := heldThreadDB(t)
+		app := &application{
+			logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+			threadModel: models.ThreadModel{DB: db},
+			pollModel:   models.PollModel{DB: db},
+			watchModel:  models.WatchModel{DB: db},
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/threads/7/watch", nil)
+		ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "7"}})
+		ctx = context.WithValue(ctx, UserContextKey, tt.user)
+
+		w := httptest.NewRecorder()
+		app.watchThreadHandler(w, r.WithContext(ctx))
+
+		if w.Code != tt.status {
+			t.Errorf("user %d: got status %d, want %d: %s", tt.user.ID, w.Code, tt.status, w.Body)
+		}
+	}
+}
+
+func TestCreateThreadRejectsInvalidCoordinates(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"latitude above the north pole", `{"lat": 90.5, "long": 0, "message": "hi"}`},
+		{"latitude below the south pole", `{"lat": -91, "long": 0, "message": "hi"}`},
+		{"longitude past the antimeridian", `{"lat": 0, "long": 180.1, "message": "hi"}`},
+		{"longitude below -180", `{"lat": 0, "long": -540, "message": "hi"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/threads", strings.NewReader(tt.body))
+			ctx := context.WithValue(r.Context(), UserContextKey, &models.User{ID: 1})
+
+			w := httptest.NewRecorder()
+			app.createThreadHandler(w, r.WithContext(ctx))
+
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "must be between") {
+				t.Errorf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+		})
+	}
+}
+
+func TestThreadRevisionsOfMissingThreadIsNotFound(t *testing.T) {
+	tests := []struct {
+		name   string
+		exists bool
+		status int
+	}{
+		{"missing", false, http.StatusNotFound},
+		{"deleted", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openFakeDB(t, func(query string, args []driver.Value) fakeResult {
+				if tt.exists && strings.HasPrefix(query, "SELECT threads.id, threads.lat") {
+					return fakeThread{deletedAt: time.Now()}.result()
+				}
+				return fakeResult{}
+			})
+			app := &application{
+				logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+				threadModel: models.ThreadModel{DB: db},
+				pollModel:   models.PollModel{DB: db},
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/threads/7/revisions", nil)
+			ctx := context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "7"}})
+
+			w := httptest.NewRecorder()
+			app.getThreadRevisionsHandler(w, r.WithContext(ctx))
+
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
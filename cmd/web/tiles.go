@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"globechat.live/internal/models"
+	"globechat.live/internal/mvt"
+)
+
+const (
+	// Below this zoom level nearby threads are merged into clusters
+	tileClusterMaxZoom = 12
+	// Size in tile pixels of the grid cells threads are clustered in
+	tileClusterCellSize = 256
+	// Most threads encoded into one tile
+	tileMaxThreads = 5000
+
+	tileCacheTTL        = 30 * time.Second
+	tileCacheMaxEntries = 10_000
+)
+
+type cachedTile struct {
+	data      []byte
+	etag      string
+	expiresAt time.Time
+}
+
+// tileCache keeps recently rendered tiles in memory so panning around the
+// map doesn't hit the database for every tile.
+type tileCache struct {
+	mu    sync.Mutex
+	tiles map[mvt.Tile]cachedTile
+}
+
+func newTileCache() *tileCache {
+	return &tileCache{tiles: make(map[mvt.Tile]cachedTile)}
+}
+
+func (c *tileCache) get(t mvt.Tile) (cachedTile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tile, ok := c.tiles[t]
+	if !ok || time.Now().After(tile.expiresAt) {
+		return cachedTile{}, false
+	}
+
+	return tile, true
+}
+
+func (c *tileCache) set(t mvt.Tile, data []byte) cachedTile {
+	sum := sha1.Sum(data)
+	tile := cachedTile{
+		data:      data,
+		etag:      `"` + hex.EncodeToString(sum[:]) + `"`,
+		expiresAt: time.Now().Add(tileCacheTTL),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.tiles) >= tileCacheMaxEntries {
+		now := time.Now()
+		for key, cached := range c.tiles {
+			if now.After(cached.expiresAt) {
+				delete(c.tiles, key)
+			}
+		}
+
+		// Everything is still fresh, start over rather than grow forever
+		if len(c.tiles) >= tileCacheMaxEntries {
+			clear(c.tiles)
+		}
+	}
+
+	c.tiles[t] = tile
+	return tile
+}
+
+func (app *application) getTileHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	y, ok := strings.CutSuffix(params.ByName("y"), ".mvt")
+	if !ok {
+		app.notFoundHandler(w, r)
+		return
+	}
+
+	var tile mvt.Tile
+	var err error
+	for _, p := range []struct {
+		name  string
+		value string
+		dst   *int
+	}{
+		{"z", params.ByName("z"), &tile.Z},
+		{"x", params.ByName("x"), &tile.X},
+		{"y", y, &tile.Y},
+	} {
+		*p.dst, err = strconv.Atoi(p.value)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("%s must be a valid number", p.name))
+			return
+		}
+	}
+
+	if !tile.Valid() {
+		app.badRequestResponse(w, r, fmt.Errorf("tile %d/%d/%d doesn't exist", tile.Z, tile.X, tile.Y))
+		return
+	}
+
+	cached, ok := app.tileCache.get(tile)
+	if !ok {
+		data, err := app.renderTile(tile)
+		if err != nil {
+			app.serverErrorResponse(w, r, err, "render tile")
+			return
+		}
+		cached = app.tileCache.set(tile, data)
+	}
+
+	w.Header().Set("ETag", cached.etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(tileCacheTTL.Seconds())))
+
+	if r.Header.Get("If-None-Match") == cached.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Write(cached.data)
+}
+
+// renderTile encodes the threads inside a tile into a "threads" layer. At
+// low zoom levels threads sharing a grid cell are drawn as a single cluster
+// feature with a point_count attribute instead.
+func (app *application) renderTile(tile mvt.Tile) ([]byte, error) {
+	points, err := app.threadModel.GetMapPoints(tile.Bounds(), tileMaxThreads)
+	if err != nil {
+		return nil, err
+	}
+
+	layer := mvt.NewLayer("threads", mvt.DefaultExtent)
+	now := time.Now()
+
+	if tile.Z >= tileClusterMaxZoom {
+		for _, p := range points {
+			x, y := tile.Project(p.Lat, p.Long, layer.Extent)
+			layer.AddPoint(uint64(p.ID), x, y, threadTileProperties(p, now)...)
+		}
+
+		return mvt.Encode(layer), nil
+	}
+
+	type cluster struct {
+		points []models.MapPoint
+		sumX   int
+		sumY   int
+	}
+
+	clusters := make(map[[2]int]*cluster)
+	var order [][2]int
+
+	for _, p := range points {
+		x, y := tile.Project(p.Lat, p.Long, layer.Extent)
+		cell := [2]int{x / tileClusterCellSize, y / tileClusterCellSize}
+
+		c, ok := clusters[cell]
+		if !ok {
+			c = &cluster{}
+			clusters[cell] = c
+			order = append(order, cell)
+		}
+
+		c.points = append(c.points, p)
+		c.sumX += x
+		c.sumY += y
+	}
+
+	for _, cell := range order {
+		c := clusters[cell]
+		x := c.sumX / len(c.points)
+		y := c.sumY / len(c.points)
+
+		if len(c.points) == 1 {
+			p := c.points[0]
+			layer.AddPoint(uint64(p.ID), x, y, threadTileProperties(p, now)...)
+			continue
+		}
+
+		// Clusters use the id of their thread with the most replies. Points
+		// come pinned first, so don't assume the first one is the busiest
+		replies := 0
+		busiest := c.points[0]
+		for _, p := range c.points {
+			replies += p.Replies
+			if p.Replies > busiest.Replies {
+				busiest = p
+			}
+		}
+
+		layer.AddPoint(uint64(busiest.ID), x, y,
+			mvt.Property{Key: "cluster", Value: true},
+			mvt.Property{Key: "point_count", Value: len(c.points)},
+			mvt.Property{Key: "replies", Value: replies},
+		)
+	}
+
+	return mvt.Encode(layer), nil
+}
+
+func threadTileProperties(p models.MapPoint, now time.Time) []mvt.Property {
+	return []mvt.Property{
+		{Key: "id", Value: p.ID},
+		{Key: "replies", Value: p.Replies},
+		{Key: "created_at", Value: p.CreatedAt.Unix()},
+		{Key: "age_hours", Value: int(now.Sub(p.CreatedAt).Hours())},
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"globechat.live/internal/models"
+	"globechat.live/internal/mvt"
+)
+
+// tileApp serves points for every tile and counts how often they were read.
+func tileApp(t *testing.T, points []models.MapPoint, queries *int) *application {
+	db := openFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		*queries++
+
+		var rows [][]driver.Value
+		for _, p := range points {
+			rows = append(rows, []driver.Value{int64(p.ID), p.Lat, p.Long, int64(p.Replies), p.CreatedAt})
+		}
+		return fakeResult{columns: make([]string, 5), rows: rows}
+	})
+
+	return &application{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		threadModel: models.ThreadModel{DB: db},
+		tileCache:   newTileCache(),
+	}
+}
+
+func getTile(app *application, z, x, y, etag string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/tiles/"+z+"/"+x+"/"+y, nil)
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+
+	params := httprouter.Params{{Key: "z", Value: z}, {Key: "x", Value: x}, {Key: "y", Value: y}}
+	r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+
+	w := httptest.NewRecorder()
+	app.getTileHandler(w, r)
+	return w
+}
+
+func TestGetTileRejectsInvalidCoordinates(t *testing.T) {
+	var queries int
+	app := tileApp(t, nil, &queries)
+
+	tests := []struct {
+		z, x, y string
+		status  int
+	}{
+		{"1", "0", "0", http.StatusNotFound},
+		{"a", "0", "0.mvt", http.StatusBadRequest},
+		{"1", "2", "0.mvt", http.StatusBadRequest},
+		{"1", "0", "-1.mvt", http.StatusBadRequest},
+		{"23", "0", "0.mvt", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		if w := getTile(app, tt.z, tt.x, tt.y, ""); w.Code != tt.status {
+			t.Errorf("%s/%s/%s: got status %d, want %d", tt.z, tt.x, tt.y, w.Code, tt.status)
+		}
+	}
+
+	if queries != 0 {
+		t.Errorf("invalid tiles made %d queries", queries)
+	}
+}
+
+func TestGetTileETag(t *testing.T) {
+	var queries int
+	app := tileApp(t, []models.MapPoint{{ID: 1, Lat: 51.5, Long: -0.12, CreatedAt: time.Now()}}, &queries)
+
+	w := getTile(app, "14", "8186", "5448.mvt", "")
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("got status %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/vnd.mapbox-vector-tile" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+
+	w = getTile(app, "14", "8186", "5448.mvt", etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("got status %d with %d bytes, want 304 and no body", w.Code, w.Body.Len())
+	}
+
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("304 has ETag %q, want %q", got, etag)
+	}
+
+	w = getTile(app, "14", "8186", "5448.mvt", `"stale"`)
+	if w.Code != http.StatusOK {
+		t.Errorf("stale ETag: got status %d, want 200", w.Code)
+	}
+
+	if queries != 1 {
+		t.Errorf("made %d queries, want 1 with the cache", queries)
+	}
+}
+
+func TestRenderTileClustersUseBusiestThread(t *testing.T) {
+	now := time.Now()
+
+	// Points come pinned first, so the first one isn't the busiest
+	points := []models.MapPoint{
+		{ID: 1, Lat: 51.50, Long: -0.12, Replies: 2, CreatedAt: now},
+		{ID: 2, Lat: 51.51, Long: -0.13, Replies: 40, CreatedAt: now},
+		{ID: 3, Lat: 51.52, Long: -0.11, Replies: 5, CreatedAt: now},
+	}
+
+	var queries int
+	app := tileApp(t, points, &queries)
+	tile := mvt.Tile{Z: 2, X: 1, Y: 1}
+
+	got, err := app.renderTile(tile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := mvt.NewLayer("threads", mvt.DefaultExtent)
+	var sumX, sumY int
+	for _, p := range points {
+		x, y := tile.Project(p.Lat, p.Long, want.Extent)
+		sumX += x
+		sumY += y
+	}
+	want.AddPoint(2, sumX/3, sumY/3,
+		mvt.Property{Key: "cluster", Value: true},
+		mvt.Property{Key: "point_count", Value: 3},
+		mvt.Property{Key: "replies", Value: 47},
+	)
+
+	if !bytes.Equal(got, mvt.Encode(want)) {
+		t.Errorf("got  % x\nwant % x", got, mvt.Encode(want))
+	}
+}
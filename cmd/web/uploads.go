@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nfnt/resize"
+	"globechat.live/internal/models"
+)
+
+const (
+	MaxUploadSize   = 10 << 20
+	MaxUploadPixels = 40_000_000 // rejects decompression bombs before decoding
+	MaxImageSide    = 2048
+	ThumbnailSide   = 320
+	// A decoded upload can take MaxUploadPixels*4 bytes, so only a few are
+	// processed at once
+	MaxConcurrentUploads = 4
+)
+
+// uploadImageHandler stores a message image. The image is decoded and
+// re-encoded as JPEG, which drops metadata and anything that isn't pixels,
+// and a thumbnail is saved next to it.
+func (app *application) uploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	// Leave some room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize+1<<20)
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			app.badRequestResponse(w, r, fmt.Errorf("image file too large"))
+			return
+		}
+		app.badRequestResponse(w, r, fmt.Errorf("image file is missing"))
+		return
+	}
+	defer file.Close()
+
+	if header.Size > MaxUploadSize {
+		app.badRequestResponse(w, r, fmt.Errorf("image file too large"))
+		return
+	}
+
+	select {
+	case app.uploadSlots <- struct{}{}:
+		defer func() { <-app.uploadSlots }()
+	case <-r.Context().Done():
+		return
+	}
+
+	img, err := decodeUpload(file)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	id, err := generateRandomID(16)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "generate upload id")
+		return
+	}
+
+	upload := models.Upload{
+		ID:     id,
+		UserId: user.ID,
+	}
+
+	// Only the downscaled image is flattened, a copy of the original would
+	// double the memory the upload takes
+	full := flatten(resize.Thumbnail(MaxImageSide, MaxImageSide, img, resize.Lanczos3))
+	upload.Width, upload.Height = full.Bounds().Dx(), full.Bounds().Dy()
+
+	size, err := app.saveUploadImage(full, id+".jpg")
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "save upload")
+		return
+	}
+	upload.Size = int(size)
+
+	thumbnail := resize.Thumbnail(ThumbnailSide, ThumbnailSide, full, resize.Lanczos3)
+	if _, err = app.saveUploadImage(thumbnail, id+"_thumb.jpg"); err != nil {
+		app.deleteUploadFiles(id)
+		app.serverErrorResponse(w, r, err, "save upload thumbnail")
+		return
+	}
+
+	upload, err = app.uploadModel.Create(upload)
+	if err != nil {
+		app.deleteUploadFiles(id)
+		app.serverErrorResponse(w, r, err, "create upload")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"upload": upload, "url": upload.URL(), "thumbnail": upload.ThumbnailURL()}, nil)
+}
+
+// decodeUpload checks the image header before decoding the whole file.
+func decodeUpload(file io.ReadSeeker) (image.Image, error) {
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image file")
+	}
+
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return nil, fmt.Errorf("image must be a jpeg, png or gif")
+	}
+
+	if config.Width*config.Height > MaxUploadPixels {
+		return nil, fmt.Errorf("image dimensions are too large")
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image file")
+	}
+
+	return img, nil
+}
+
+// flatten draws img onto white, since uploads are stored as JPEG which has
+// no transparency.
+func flatten(img image.Image) *image.RGBA {
+	flat := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	return flat
+}
+
+func (app *application) uploadsDir() string {
+	return filepath.Join(app.config.mediaDir, "uploads")
+}
+
+// saveUploadImage writes img as a JPEG into the uploads directory and
+// returns the file size.
+func (app *application) saveUploadImage(img image.Image, filename string) (int64, error) {
+	if err := os.MkdirAll(app.uploadsDir(), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create uploads directory: %w", err)
+	}
+
+	path := filepath.Join(app.uploadsDir(), filename)
+	if err := saveJPEG(img, path); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+func (app *application) deleteUploadFiles(id string) {
+	for _, filename := range []string{id + ".jpg", id + "_thumb.jpg"} {
+		err := os.Remove(filepath.Join(app.uploadsDir(), filename))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			app.logger.Error(err.Error(), "action", "delete upload file")
+		}
+	}
+}
+
+// deleteUnusedUploads removes uploads that were never attached to a message
+// or whose message was deleted.
+func (app *application) deleteUnusedUploads() error {
+	ids, err := app.uploadModel.DeleteUnused(time.Now().Add(-app.config.uploadTTL))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		app.deleteUploadFiles(id)
+	}
+
+	return nil
+}
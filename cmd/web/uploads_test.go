@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+func TestDecodeUploadRejectsInvalidImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Claim 65535x65535 in the screen descriptor, only the header is read
+	// so the missing pixels never matter
+	huge := buf.Bytes()
+	copy(huge[6:10], []byte{0xff, 0xff, 0xff, 0xff})
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not an image", []byte("not an image")},
+		{"unsupported format", []byte("BM not really a bitmap")},
+		{"too many pixels", huge},
+	}
+
+	for _, tt := range tests {
+		if _, err := decodeUpload(bytes.NewReader(tt.data)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	_, err := decodeUpload(bytes.NewReader(huge))
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("got %v, want the dimensions to be rejected", err)
+	}
+}
+
+func TestFlattenDrawsOntoWhite(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(10, 10, 12, 11))
+	img.Set(10, 10, color.NRGBA{})
+	img.Set(11, 10, color.NRGBA{R: 255, A: 255})
+
+	flat := flatten(img)
+
+	if flat.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("got bounds %v", flat.Bounds())
+	}
+
+	if got := flat.RGBAAt(0, 0); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("transparent pixel became %v, want white", got)
+	}
+
+	if got := flat.RGBAAt(1, 0); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("opaque pixel became %v, want red", got)
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"globechat.live/internal/geo"
 	"globechat.live/internal/models"
 )
 
@@ -26,6 +28,29 @@ func (app *application) updateUserInfoHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	user := app.getUserFromRequst(r)
+
+	// Location precision is optional, empty resets it to the server default
+	locationPrecision := user.LocationPrecision
+	if r.MultipartForm != nil && r.MultipartForm.Value["location_precision"] != nil {
+		locationPrecision = r.FormValue("location_precision")
+		if locationPrecision != "" {
+			if _, err := geo.ParsePrecision(locationPrecision); err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	// Mentions are optional too, leaving it out keeps the current setting
+	mentionsEnabled := user.MentionsEnabled
+	if r.MultipartForm != nil && r.MultipartForm.Value["mentions_enabled"] != nil {
+		mentionsEnabled, err = strconv.ParseBool(r.FormValue("mentions_enabled"))
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("mentions_enabled must be true or false"))
+			return
+		}
+	}
+
 	var imageURL string
 
 	// Check if an image file was uploaded
@@ -66,7 +91,23 @@ func (app *application) updateUserInfoHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	app.writeJSON(w, 200, envelope{"message": "Updated successfully", "image_url": imageURL}, nil)
+	if locationPrecision != user.LocationPrecision {
+		err = app.userModel.UpdateLocationPrecision(user.ID, locationPrecision)
+		if err != nil {
+			app.serverErrorResponse(w, r, err, "update location precision")
+			return
+		}
+	}
+
+	if mentionsEnabled != user.MentionsEnabled {
+		err = app.userModel.UpdateMentionsEnabled(user.ID, mentionsEnabled)
+		if err != nil {
+			app.serverErrorResponse(w, r, err, "update mentions preference")
+			return
+		}
+	}
+
+	app.writeJSON(w, 200, envelope{"message": "Updated successfully", "image_url": imageURL, "location_precision": locationPrecision, "mentions_enabled": mentionsEnabled}, nil)
 }
 
 func (app *application) queryUsersHandler(w http.ResponseWriter, r *http.Request) {
@@ -98,11 +139,18 @@ func (app *application) queryUsersHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	cursor, err := app.readCursor(queryParams)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	// Create query struct
 	query := models.UserQuery{
 		Search:    search,
 		PageSize:  pageSize,
 		PageIndex: pageIndex,
+		Cursor:    cursor,
 	}
 
 	// Execute query
@@ -132,6 +180,9 @@ func (app *application) queryUsersHandler(w http.ResponseWriter, r *http.Request
 			"total_pages": totalPages,
 			"has_next":    hasNext,
 			"has_prev":    hasPrev,
+			"next":        result.Next,
+			"prev":        result.Prev,
+			"has_more":    result.HasMore,
 		},
 	}
 
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"globechat.live/internal/models"
+)
+
+func (app *application) watchThreadHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	threadId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	thread, err := app.threadModel.GetById(threadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "fetching thread")
+		return
+	}
+
+	if !app.canSeeThread(r, thread) {
+		app.notFoundResponse(w, r, fmt.Errorf("thread not found"))
+		return
+	}
+
+	err = app.watchModel.Watch(user.ID, threadId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "watch thread")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"message": "watching thread"}, nil)
+}
+
+func (app *application) unwatchThreadHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	threadId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.watchModel.Unwatch(user.ID, threadId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("you are not watching this thread"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "unwatch thread")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"message": "stopped watching thread"}, nil)
+}
+
+func (app *application) getWatchingHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromRequst(r)
+
+	watching, err := app.watchModel.GetByUserId(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching watched threads")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"watching": watching}, nil)
+}
+
+// markMessagesRead advances the user's read marker for a watched thread to
+// the newest of the messages they were just sent.
+func (app *application) markMessagesRead(r *http.Request, threadId int, messages []models.Message) {
+	if !app.isAuthenticated(r) || len(messages) == 0 {
+		return
+	}
+
+	user := app.getUserFromRequst(r)
+
+	newest := 0
+	for _, message := range messages {
+		newest = max(newest, message.ID)
+	}
+
+	err := app.watchModel.MarkRead(user.ID, threadId, newest)
+	if err != nil {
+		app.logError(r, err, "mark messages read")
+	}
+}
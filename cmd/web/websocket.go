@@ -3,14 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
-	"golang.org/x/time/rate"
-
 	"github.com/coder/websocket"
+	"globechat.live/internal/models"
 )
 
 type WebsocketConnectionMessage struct {
@@ -21,12 +21,67 @@ type WebsocketConnectionMessage struct {
 
 type WebSocketRoomManager struct {
 	rooms map[int]map[*websocket.Conn]bool // room_id -> set of connections
+	users map[int]map[*websocket.Conn]bool // user_id -> connections of signed in users
 	mu    sync.RWMutex
 }
 
 func NewWebSocketRoomManager() *WebSocketRoomManager {
 	return &WebSocketRoomManager{
 		rooms: make(map[int]map[*websocket.Conn]bool),
+		users: make(map[int]map[*websocket.Conn]bool),
+	}
+}
+
+// addUser remembers which user a connection belongs to so events can be
+// sent to them outside of rooms.
+func (m *WebSocketRoomManager) addUser(c *websocket.Conn, userId int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[userId] == nil {
+		m.users[userId] = make(map[*websocket.Conn]bool)
+	}
+
+	m.users[userId][c] = true
+}
+
+func (m *WebSocketRoomManager) removeUser(c *websocket.Conn, userId int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if conns, exists := m.users[userId]; exists {
+		delete(conns, c)
+
+		if len(conns) == 0 {
+			delete(m.users, userId)
+		}
+	}
+}
+
+// notifyUser sends message to every connection the user has open. Nothing
+// is sent when they are offline.
+func (m *WebSocketRoomManager) notifyUser(userId int, message WebsocketConnectionMessage) {
+	m.mu.RLock()
+	connections := make([]*websocket.Conn, 0, len(m.users[userId]))
+	for conn := range m.users[userId] {
+		connections = append(connections, conn)
+	}
+	m.mu.RUnlock()
+
+	if len(connections) == 0 {
+		return
+	}
+
+	js, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	for _, conn := range connections {
+		err := conn.Write(context.Background(), websocket.MessageText, js)
+		if err != nil {
+			m.removeUser(conn, userId)
+		}
 	}
 }
 
@@ -109,15 +164,20 @@ func (app *application) websocketConnectionHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
+	// Signed in users also get events addressed to them, like mentions
+	if app.isAuthenticated(r) {
+		userId := app.getUserFromRequst(r).ID
+		app.roomManager.addUser(c, userId)
+		defer app.roomManager.removeUser(c, userId)
+	}
+
 	defer func() {
 		app.roomManager.leaveAllRooms(c)
 		c.CloseNow()
 	}()
 
-	l := rate.NewLimiter(rate.Every(time.Millisecond*100), 10)
-
 	for {
-		err := app.handleMessage(c, l)
+		err := app.handleMessage(r, c)
 
 		if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
 			return
@@ -130,15 +190,10 @@ func (app *application) websocketConnectionHandler(w http.ResponseWriter, r *htt
 	}
 }
 
-func (app *application) handleMessage(c *websocket.Conn, l *rate.Limiter) error {
+func (app *application) handleMessage(r *http.Request, c *websocket.Conn) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Hour*5)
 	defer cancel()
 
-	err := l.Wait(ctx)
-	if err != nil {
-		return err
-	}
-
 	typ, data, err := c.Read(ctx)
 	if err != nil {
 		return err
@@ -155,7 +210,22 @@ func (app *application) handleMessage(c *websocket.Conn, l *rate.Limiter) error
 
 	switch msg.Type {
 	case "join":
-		app.roomManager.joinRoom(c, msg.RoomID)
+		if retryAfter, ok := app.allowAction(r, actionWebsocketJoin); !ok {
+			return app.sendRateLimited(ctx, c, msg.RoomID, retryAfter)
+		}
+
+		// Rooms are threads, hidden ones can't be followed by others
+		thread, err := app.threadModel.GetById(msg.RoomID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				return nil
+			}
+			return err
+		}
+
+		if app.canSeeThread(r, thread) {
+			app.roomManager.joinRoom(c, msg.RoomID)
+		}
 	case "leave":
 		app.roomManager.leaveRoom(c, msg.RoomID)
 
@@ -165,3 +235,21 @@ func (app *application) handleMessage(c *websocket.Conn, l *rate.Limiter) error
 
 	return nil
 }
+
+// sendRateLimited tells the client a join was refused and when it can
+// retry, the connection itself stays open.
+func (app *application) sendRateLimited(ctx context.Context, c *websocket.Conn, roomId int, retryAfter time.Duration) error {
+	js, err := json.Marshal(WebsocketConnectionMessage{
+		Type:   "rate-limited",
+		RoomID: roomId,
+		Data: map[string]any{
+			"action":      actionWebsocketJoin,
+			"retry_after": retryAfterSeconds(retryAfter),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Write(ctx, websocket.MessageText, js)
+}
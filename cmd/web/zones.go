@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"globechat.live/internal/geo"
+	"globechat.live/internal/models"
+)
+
+// zoneInput is the editable part of a zone, shared by the JSON endpoints and
+// GeoJSON feature properties.
+type zoneInput struct {
+	Name          string      `json:"name"`
+	Kind          string      `json:"kind"`
+	CenterLat     float64     `json:"center_lat"`
+	CenterLong    float64     `json:"center_long"`
+	RadiusKm      float64     `json:"radius_km"`
+	Polygon       geo.Polygon `json:"polygon"`
+	NoNewThreads  bool        `json:"no_new_threads"`
+	ReadOnly      bool        `json:"read_only"`
+	ThreadLimit   int         `json:"thread_limit"`
+	RequireReview bool        `json:"require_review"`
+}
+
+func (input zoneInput) toZone() models.Zone {
+	return models.Zone{
+		Name:          strings.TrimSpace(input.Name),
+		Kind:          input.Kind,
+		CenterLat:     input.CenterLat,
+		CenterLong:    input.CenterLong,
+		RadiusKm:      input.RadiusKm,
+		Polygon:       input.Polygon,
+		NoNewThreads:  input.NoNewThreads,
+		ReadOnly:      input.ReadOnly,
+		ThreadLimit:   input.ThreadLimit,
+		RequireReview: input.RequireReview,
+	}
+}
+
+func validCoordinate(lat, long float64) bool {
+	return !math.IsNaN(lat) && !math.IsNaN(long) && lat >= -90 && lat <= 90 && long >= -180 && long <= 180
+}
+
+func validateZone(zone models.Zone) error {
+	if len(zone.Name) == 0 || len(zone.Name) > 100 {
+		return fmt.Errorf("name length must be between 1-100 characters")
+	}
+
+	if zone.ThreadLimit < 0 {
+		return fmt.Errorf("thread_limit must not be negative")
+	}
+
+	switch zone.Kind {
+	case models.ZoneCircle:
+		if !validCoordinate(zone.CenterLat, zone.CenterLong) {
+			return fmt.Errorf("center must be a valid coordinate")
+		}
+		if zone.RadiusKm <= 0 || zone.RadiusKm > 1000 {
+			return fmt.Errorf("radius_km must be between 0 and 1000")
+		}
+	case models.ZonePolygon:
+		if len(zone.Polygon) < 3 {
+			return fmt.Errorf("polygon needs at least 3 points")
+		}
+		for _, point := range zone.Polygon {
+			if !validCoordinate(point.Lat, point.Long) {
+				return fmt.Errorf("polygon contains an invalid coordinate")
+			}
+		}
+		if zone.Polygon.CrossesAntimeridian() {
+			return fmt.Errorf("polygon must not cross the antimeridian, split it in two")
+		}
+	default:
+		return fmt.Errorf("kind must be circle or polygon")
+	}
+
+	return nil
+}
+
+func (app *application) getZonesHandler(w http.ResponseWriter, r *http.Request) {
+	zones, err := app.zoneModel.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "fetching zones")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"zones": zones}, nil)
+}
+
+func (app *application) createZoneHandler(w http.ResponseWriter, r *http.Request) {
+	var input zoneInput
+
+	err := app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	zone := input.toZone()
+	if err := validateZone(zone); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	zone, err = app.zoneModel.Create(zone)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "create zone")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"zone": zone}, nil)
+}
+
+func (app *application) updateZoneHandler(w http.ResponseWriter, r *http.Request) {
+	zoneId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input zoneInput
+
+	err = app.readJSONFromRequest(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	zone := input.toZone()
+	zone.ID = zoneId
+	if err := validateZone(zone); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	zone, err = app.zoneModel.Update(zone)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("zone not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "update zone")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"zone": zone}, nil)
+}
+
+func (app *application) deleteZoneHandler(w http.ResponseWriter, r *http.Request) {
+	zoneId, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.zoneModel.Delete(zoneId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r, fmt.Errorf("zone not found"))
+			return
+		}
+		app.serverErrorResponse(w, r, err, "delete zone")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"message": "zone deleted"}, nil)
+}
+
+// importZonesHandler creates a zone for every feature of a GeoJSON
+// FeatureCollection. Polygons become polygon zones and Points become circle
+// zones, which need a radius_km property. Rules and the name are read from
+// the feature properties. Nothing is created unless every feature is valid.
+func (app *application) importZonesHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", 10<<20))
+		return
+	}
+
+	features, err := geo.ParseFeatureCollection(data)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	zones := make([]models.Zone, 0, len(features))
+
+	for i, feature := range features {
+		var input zoneInput
+		if len(feature.Properties) > 0 && string(feature.Properties) != "null" {
+			if err := json.Unmarshal(feature.Properties, &input); err != nil {
+				app.badRequestResponse(w, r, fmt.Errorf("feature %d: invalid properties", i))
+				return
+			}
+		}
+
+		if feature.Point != nil {
+			input.Kind = models.ZoneCircle
+			input.CenterLat = feature.Point.Lat
+			input.CenterLong = feature.Point.Long
+			input.Polygon = nil
+		} else {
+			input.Kind = models.ZonePolygon
+			input.Polygon = feature.Polygon
+		}
+
+		zone := input.toZone()
+		if err := validateZone(zone); err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("feature %d: %w", i, err))
+			return
+		}
+
+		zones = append(zones, zone)
+	}
+
+	created, err := app.zoneModel.CreateMany(zones)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, "import zones")
+		return
+	}
+
+	app.writeJSON(w, 200, envelope{"zones": created}, nil)
+}
+
+// zoneNames lists the zones for error messages.
+func zoneNames(zones []models.Zone) string {
+	names := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		names = append(names, zone.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,145 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Action is what happens to text a rule matched.
+type Action string
+
+const (
+	// Mask replaces the matched text with asterisks
+	Mask Action = "mask"
+	// Shadow stores the text but only shows it to its author
+	Shadow Action = "shadow"
+	// Hold stores the text but hides it until a moderator approves it
+	Hold Action = "hold"
+	// Reject refuses to store the text at all
+	Reject Action = "reject"
+)
+
+// severity orders the actions, the strictest action of all the rules that
+// matched wins.
+var severity = map[Action]int{Mask: 1, Shadow: 2, Hold: 3, Reject: 4}
+
+func ParseAction(s string) (Action, error) {
+	action := Action(s)
+	if _, ok := severity[action]; !ok {
+		return "", fmt.Errorf("action must be one of mask, shadow, hold or reject")
+	}
+	return action, nil
+}
+
+// Span is a byte range of the inspected text.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Filter finds the parts of a text that break one kind of rule.
+type Filter interface {
+	Match(text string) []Span
+}
+
+// Rule pairs a filter with the action taken when it matches. ID is only
+// carried through to the hits.
+type Rule struct {
+	ID     int
+	Action Action
+	Filter Filter
+}
+
+// Hit records one rule that matched.
+type Hit struct {
+	RuleID int
+	Action Action
+	// The first piece of text the rule matched
+	Match string
+}
+
+type Result struct {
+	// The text with every masked span replaced
+	Text string
+	// The strictest action of the rules that matched, empty when none did
+	Action Action
+	Hits   []Hit
+}
+
+// Chain runs text through a list of rules. It is immutable so a single
+// chain can be shared between requests.
+type Chain struct {
+	rules []Rule
+}
+
+func NewChain(rules ...Rule) *Chain {
+	return &Chain{rules: rules}
+}
+
+func (c *Chain) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.rules)
+}
+
+// Apply runs every rule against text. Masks are applied whatever the final
+// action is, so held and shadowed text is stored masked too.
+func (c *Chain) Apply(text string) Result {
+	result := Result{Text: text}
+	if c == nil {
+		return result
+	}
+
+	var masked []Span
+	for _, rule := range c.rules {
+		spans := rule.Filter.Match(text)
+		if len(spans) == 0 {
+			continue
+		}
+
+		result.Hits = append(result.Hits, Hit{
+			RuleID: rule.ID,
+			Action: rule.Action,
+			Match:  text[spans[0].Start:spans[0].End],
+		})
+
+		if severity[rule.Action] > severity[result.Action] {
+			result.Action = rule.Action
+		}
+
+		if rule.Action == Mask {
+			masked = append(masked, spans...)
+		}
+	}
+
+	if len(masked) > 0 {
+		result.Text = mask(text, masked)
+	}
+
+	return result
+}
+
+// mask replaces every rune touched by spans with an asterisk.
+func mask(text string, spans []Span) string {
+	hidden := make([]bool, len(text))
+	for _, span := range spans {
+		for i := span.Start; i < span.End; i++ {
+			hidden[i] = true
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		if hidden[i] {
+			b.WriteByte('*')
+		} else {
+			b.WriteString(text[i : i+size])
+		}
+		i += size
+	}
+
+	return b.String()
+}
@@ -0,0 +1,206 @@
+package filter
+
+import (
+	"slices"
+	"testing"
+)
+
+// matches returns the pieces of text f matched.
+func matches(f Filter, text string) []string {
+	var found []string
+	for _, span := range f.Match(text) {
+		found = append(found, text[span.Start:span.End])
+	}
+	return found
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		pattern string
+		text    string
+		want    []string
+	}{
+		{"whole word", KindWords, "spam", "buy spam now", []string{"spam"}},
+		{"word ignoring case", KindWords, "spam", "SPAM and Spam", []string{"SPAM", "Spam"}},
+		{"word inside another word", KindWords, "ass", "a classic assessment", nil},
+		{"word next to punctuation", KindWords, "spam", "(spam), spam!", []string{"spam", "spam"}},
+		{"phrase", KindWords, "free money, win", "get free money to win", []string{"free money", "win"}},
+		{"phrase with other spacing", KindWords, "free money", "free  money", nil},
+		{"word ending in a symbol", KindWords, "c++", "I like c++, not c", []string{"c++"}},
+		{"list on new lines", KindWords, "foo\n\nbar\n", "bar foo", []string{"bar", "foo"}},
+		{"regex", KindRegex, `\d{3}-\d{4}`, "call 555-1234 or 555-9876", []string{"555-1234", "555-9876"}},
+		{"regex is case sensitive", KindRegex, `spam`, "SPAM", nil},
+		{"regex matching nothing", KindRegex, `x*`, "abc", nil},
+		{"domain", KindDomains, "evil.com", "see https://evil.com/page", []string{"https://evil.com/page"}},
+		{"bare domain", KindDomains, "evil.com", "go to evil.com now", []string{"evil.com"}},
+		{"subdomain", KindDomains, "evil.com", "http://www.EVIL.com", []string{"http://www.EVIL.com"}},
+		{"domain suffix of another domain", KindDomains, "evil.com", "https://notevil.com", nil},
+		{"domain as a subdomain elsewhere", KindDomains, "evil.com", "https://evil.com.example.org", nil},
+		{"wildcard domain", KindDomains, "*.evil.com.", "mail.evil.com", []string{"mail.evil.com"}},
+		{"domain with port and query", KindDomains, "evil.com", "evil.com:8080/?q=1 ok", []string{"evil.com:8080/?q=1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Compile(tt.kind, tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := matches(f, tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRejectsInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		kind    string
+		pattern string
+	}{
+		{"unknown", "spam"},
+		{KindWords, " ,\n"},
+		{KindRegex, "  "},
+		{KindRegex, "(unclosed"},
+		{KindDomains, ""},
+		{KindShouting, "caps"},
+		{KindShouting, "caps=1.5"},
+		{KindShouting, "min=-1"},
+		{KindShouting, "volume=11"},
+	}
+
+	for _, tt := range tests {
+		if _, err := Compile(tt.kind, tt.pattern); err == nil {
+			t.Errorf("%s %q: expected an error", tt.kind, tt.pattern)
+		}
+	}
+}
+
+func TestShouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		text    string
+		want    []string
+	}{
+		{"calm", "", "Hello there, how are you?", nil},
+		{"shouting", "", "HELLO THERE HOW ARE YOU", []string{"HELLO THERE HOW ARE YOU"}},
+		{"exactly at the ratio", "", "ABCDEFGhij", []string{"ABCDEFGhij"}},
+		{"just below the ratio", "", "ABCDEFghij", nil},
+		{"too short to shout", "", "OK THANKS", nil},
+		{"lower minimum", "min=2", "OK THANKS", []string{"OK THANKS"}},
+		{"only letters count", "", "HELLO!!! 12345 WORLD", []string{"HELLO!!! 12345 WORLD"}},
+		{"caps check off", "caps=0", "HELLO THERE HOW ARE YOU", nil},
+		{"repeated characters", "", "soooooo good", []string{"oooooo"}},
+		{"repeat below the limit", "", "sooooo good", nil},
+		{"repeat at the end", "repeat=3", "wow!!!", []string{"!!!"}},
+		{"repeated spaces", "repeat=3", "a      b", nil},
+		{"repeat check off", "repeat=0", "sooooooooo good", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseShouting(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := matches(f, tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustCompile(t *testing.T, kind, pattern string) Filter {
+	t.Helper()
+	f, err := Compile(kind, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestChainApply(t *testing.T) {
+	words := mustCompile(t, KindWords, "darn, heck")
+	domains := mustCompile(t, KindDomains, "evil.com")
+	regex := mustCompile(t, KindRegex, `cr[yi]pto`)
+
+	tests := []struct {
+		name   string
+		rules  []Rule
+		text   string
+		want   string
+		action Action
+		hits   []int
+	}{
+		{"no rules match", []Rule{{ID: 1, Action: Mask, Filter: words}}, "hello", "hello", "", nil},
+		{"mask", []Rule{{ID: 1, Action: Mask, Filter: words}}, "darn it, heck", "**** it, ****", Mask, []int{1}},
+		{"mask multibyte runes", []Rule{{ID: 1, Action: Mask, Filter: regex}}, "crypto ☃ cripto", "****** ☃ ******", Mask, []int{1}},
+		{"overlapping masks", []Rule{
+			{ID: 1, Action: Mask, Filter: mustCompile(t, KindRegex, "abc")},
+			{ID: 2, Action: Mask, Filter: mustCompile(t, KindRegex, "bcd")},
+		}, "xabcdx", "x****x", Mask, []int{1, 2}},
+		{"hold beats mask", []Rule{
+			{ID: 1, Action: Mask, Filter: words},
+			{ID: 2, Action: Hold, Filter: domains},
+		}, "darn evil.com", "**** evil.com", Hold, []int{1, 2}},
+		{"reject beats hold", []Rule{
+			{ID: 1, Action: Reject, Filter: regex},
+			{ID: 2, Action: Hold, Filter: domains},
+		}, "crypto on evil.com", "crypto on evil.com", Reject, []int{1, 2}},
+		{"hold beats shadow", []Rule{
+			{ID: 1, Action: Shadow, Filter: words},
+			{ID: 2, Action: Hold, Filter: regex},
+			{ID: 3, Action: Shadow, Filter: domains},
+		}, "heck crypto", "heck crypto", Hold, []int{1, 2}},
+		{"shadow beats mask", []Rule{
+			{ID: 1, Action: Shadow, Filter: regex},
+			{ID: 2, Action: Mask, Filter: words},
+		}, "heck crypto", "**** crypto", Shadow, []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewChain(tt.rules...).Apply(tt.text)
+
+			if result.Text != tt.want {
+				t.Errorf("got text %q, want %q", result.Text, tt.want)
+			}
+			if result.Action != tt.action {
+				t.Errorf("got action %q, want %q", result.Action, tt.action)
+			}
+
+			var hits []int
+			for _, hit := range result.Hits {
+				hits = append(hits, hit.RuleID)
+			}
+			if !slices.Equal(hits, tt.hits) {
+				t.Errorf("got hits %v, want %v", hits, tt.hits)
+			}
+		})
+	}
+}
+
+func TestChainRecordsFirstMatch(t *testing.T) {
+	chain := NewChain(Rule{ID: 4, Action: Hold, Filter: mustCompile(t, KindWords, "heck")})
+
+	result := chain.Apply("what the HECK, heck")
+	if len(result.Hits) != 1 || result.Hits[0].Match != "HECK" || result.Hits[0].Action != Hold {
+		t.Errorf("unexpected hits %+v", result.Hits)
+	}
+}
+
+func TestNilChain(t *testing.T) {
+	var chain *Chain
+
+	if chain.Len() != 0 {
+		t.Errorf("got length %d", chain.Len())
+	}
+	if result := chain.Apply("anything"); result.Text != "anything" || result.Action != "" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
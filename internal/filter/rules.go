@@ -0,0 +1,229 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The kinds of built-in filters a rule can use.
+const (
+	KindWords    = "words"
+	KindRegex    = "regex"
+	KindDomains  = "domains"
+	KindShouting = "shouting"
+)
+
+// Compile builds the filter of kind from a rule's pattern:
+//
+//   - words: words or phrases separated by commas or new lines, matched as
+//     whole words ignoring case
+//   - regex: a Go regular expression
+//   - domains: domains separated by commas or new lines, matching links to
+//     them or any of their subdomains
+//   - shouting: optional settings like "caps=0.7 repeat=6 min=10", see
+//     Shouting
+func Compile(kind string, pattern string) (Filter, error) {
+	switch kind {
+	case KindWords:
+		return NewWordList(splitList(pattern))
+	case KindRegex:
+		return NewRegex(pattern)
+	case KindDomains:
+		return NewDomainBlocklist(splitList(pattern))
+	case KindShouting:
+		return ParseShouting(pattern)
+	default:
+		return nil, fmt.Errorf("kind must be one of words, regex, domains or shouting")
+	}
+}
+
+func splitList(pattern string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(pattern, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+type regexFilter struct {
+	re *regexp.Regexp
+}
+
+func (f regexFilter) Match(text string) []Span {
+	var spans []Span
+	for _, loc := range f.re.FindAllStringIndex(text, -1) {
+		if loc[1] > loc[0] {
+			spans = append(spans, Span{loc[0], loc[1]})
+		}
+	}
+	return spans
+}
+
+func NewRegex(pattern string) (Filter, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, fmt.Errorf("pattern must not be empty")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	return regexFilter{re: re}, nil
+}
+
+// NewWordList matches any of words as a whole word, ignoring case.
+func NewWordList(words []string) (Filter, error) {
+	if len(words) == 0 {
+		return nil, fmt.Errorf("pattern must list at least one word")
+	}
+
+	// Word boundaries only make sense next to word characters, so a word
+	// like "c++" can still be listed
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+		if isWordChar(word[0]) {
+			quoted[i] = `\b` + quoted[i]
+		}
+		if isWordChar(word[len(word)-1]) {
+			quoted[i] += `\b`
+		}
+	}
+
+	re := regexp.MustCompile(`(?i)` + strings.Join(quoted, "|"))
+	return regexFilter{re: re}, nil
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// hostPattern finds links and bare domain names like example.com/path.
+var hostPattern = regexp.MustCompile(`(?i)(?:https?://)?((?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,})(?:[:/?#][^\s<>"]*)?`)
+
+type domainFilter struct {
+	domains []string
+}
+
+// NewDomainBlocklist matches links to any of domains or their subdomains.
+func NewDomainBlocklist(domains []string) (Filter, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("pattern must list at least one domain")
+	}
+
+	f := domainFilter{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "*."))
+		f.domains = append(f.domains, strings.TrimSuffix(domain, "."))
+	}
+
+	return f, nil
+}
+
+func (f domainFilter) Match(text string) []Span {
+	var spans []Span
+	for _, loc := range hostPattern.FindAllStringSubmatchIndex(text, -1) {
+		host := strings.ToLower(text[loc[2]:loc[3]])
+		for _, domain := range f.domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				spans = append(spans, Span{loc[0], loc[1]})
+				break
+			}
+		}
+	}
+	return spans
+}
+
+// Shouting flags text written mostly in capitals and characters repeated
+// many times in a row.
+type Shouting struct {
+	// Share of upper case letters above which text is shouting
+	CapsRatio float64
+	// Texts with fewer letters than this are never shouting
+	MinLetters int
+	// Runs of the same character at least this long match
+	MaxRepeat int
+}
+
+var DefaultShouting = Shouting{CapsRatio: 0.7, MinLetters: 10, MaxRepeat: 6}
+
+// ParseShouting reads space or comma separated caps, min and repeat
+// settings, starting from DefaultShouting. A setting of 0 turns that check
+// off.
+func ParseShouting(pattern string) (Filter, error) {
+	s := DefaultShouting
+
+	for _, field := range strings.FieldsFunc(pattern, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("shouting settings must look like caps=0.7 repeat=6 min=10")
+		}
+
+		var err error
+		switch key {
+		case "caps":
+			s.CapsRatio, err = strconv.ParseFloat(value, 64)
+			if err == nil && (s.CapsRatio < 0 || s.CapsRatio > 1) {
+				err = fmt.Errorf("out of range")
+			}
+		case "min":
+			s.MinLetters, err = strconv.Atoi(value)
+		case "repeat":
+			s.MaxRepeat, err = strconv.Atoi(value)
+		default:
+			return nil, fmt.Errorf("unknown shouting setting %q", key)
+		}
+
+		if err != nil || s.MinLetters < 0 || s.MaxRepeat < 0 {
+			return nil, fmt.Errorf("invalid value for shouting setting %q", key)
+		}
+	}
+
+	return s, nil
+}
+
+func (s Shouting) Match(text string) []Span {
+	var spans []Span
+
+	if s.CapsRatio > 0 {
+		var letters, upper int
+		for _, r := range text {
+			if unicode.IsLetter(r) {
+				letters++
+				if unicode.IsUpper(r) {
+					upper++
+				}
+			}
+		}
+
+		if letters >= s.MinLetters && letters > 0 && float64(upper)/float64(letters) >= s.CapsRatio {
+			spans = append(spans, Span{0, len(text)})
+		}
+	}
+
+	if s.MaxRepeat > 1 {
+		start, count := 0, 0
+		var previous rune
+		for i, r := range text {
+			if r == previous && !unicode.IsSpace(r) {
+				count++
+			} else {
+				if count >= s.MaxRepeat {
+					spans = append(spans, Span{start, i})
+				}
+				start, count, previous = i, 1, r
+			}
+		}
+		if count >= s.MaxRepeat {
+			spans = append(spans, Span{start, len(text)})
+		}
+	}
+
+	return spans
+}
@@ -0,0 +1,102 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrInvalidCoordinate = errors.New("coordinate must be a finite number")
+	ErrInvalidLatRange   = errors.New("minLat must not be greater than maxLat")
+)
+
+// BoundingBox is a lat/long rectangle that never crosses the antimeridian,
+// so MinLong <= MaxLong always holds and it maps directly to a BETWEEN query.
+type BoundingBox struct {
+	MinLat  float64
+	MinLong float64
+	MaxLat  float64
+	MaxLong float64
+}
+
+// Contains reports whether the point lies inside the box, edges included.
+func (b BoundingBox) Contains(lat, long float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && long >= b.MinLong && long <= b.MaxLong
+}
+
+// NormalizeLong wraps a longitude into the [-180, 180) range, so every
+// meridian has exactly one representation.
+func NormalizeLong(long float64) float64 {
+	if long >= -180 && long < 180 {
+		return long
+	}
+
+	long = math.Mod(long+180, 360)
+	if long < 0 {
+		long += 360
+	}
+
+	return long - 180
+}
+
+// ClampLat limits a latitude to the [-90, 90] range.
+func ClampLat(lat float64) float64 {
+	return math.Max(-90, math.Min(90, lat))
+}
+
+// SplitBounds turns a viewport as reported by a map client into one or two
+// boxes that can be queried directly.
+//
+// Latitudes are clamped to the poles. Longitudes are normalised first; a
+// viewport whose west edge ends up east of its east edge crosses the
+// antimeridian and is split in two. A viewport spanning 360° or more covers
+// every longitude.
+func SplitBounds(minLat, minLong, maxLat, maxLong float64) ([]BoundingBox, error) {
+	coordinates := []struct {
+		name  string
+		value float64
+	}{
+		{"minLat", minLat},
+		{"minLong", minLong},
+		{"maxLat", maxLat},
+		{"maxLong", maxLong},
+	}
+
+	for _, c := range coordinates {
+		if math.IsNaN(c.value) || math.IsInf(c.value, 0) {
+			return nil, fmt.Errorf("%s: %w", c.name, ErrInvalidCoordinate)
+		}
+	}
+
+	if minLat > maxLat {
+		return nil, ErrInvalidLatRange
+	}
+
+	minLat = ClampLat(minLat)
+	maxLat = ClampLat(maxLat)
+
+	// Maps let users keep panning east, so maxLong can legitimately be
+	// smaller than minLong only once both have been wrapped
+	if maxLong-minLong >= 360 {
+		return []BoundingBox{{MinLat: minLat, MinLong: -180, MaxLat: maxLat, MaxLong: 180}}, nil
+	}
+
+	minLong = NormalizeLong(minLong)
+	maxLong = NormalizeLong(maxLong)
+
+	// An east edge on the antimeridian wraps to -180 but still closes the
+	// box at 180
+	if maxLong == -180 && minLong > maxLong {
+		maxLong = 180
+	}
+
+	if minLong <= maxLong {
+		return []BoundingBox{{MinLat: minLat, MinLong: minLong, MaxLat: maxLat, MaxLong: maxLong}}, nil
+	}
+
+	return []BoundingBox{
+		{MinLat: minLat, MinLong: minLong, MaxLat: maxLat, MaxLong: 180},
+		{MinLat: minLat, MinLong: -180, MaxLat: maxLat, MaxLong: maxLong},
+	}, nil
+}
@@ -0,0 +1,134 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// viewport is a random map viewport: a latitude range and a west edge
+// panned any number of turns around the globe, with a width under 360°.
+type viewport struct {
+	MinLat, MaxLat float64
+	MinLong, Width float64
+	// Offsets of a probe point from the south west corner
+	PointLat, PointLong float64
+}
+
+func (viewport) Generate(r *rand.Rand, size int) reflect.Value {
+	a, b := r.Float64()*180-90, r.Float64()*180-90
+	return reflect.ValueOf(viewport{
+		MinLat:    math.Min(a, b),
+		MaxLat:    math.Max(a, b),
+		MinLong:   r.Float64()*1440 - 720,
+		Width:     r.Float64() * 360,
+		PointLat:  r.Float64()*180 - 90,
+		PointLong: r.Float64() * 360,
+	})
+}
+
+func TestSplitBoundsUnionEqualsWrappedBox(t *testing.T) {
+	const epsilon = 1e-9
+
+	property := func(v viewport) bool {
+		boxes, err := SplitBounds(v.MinLat, v.MinLong, v.MaxLat, v.MinLong+v.Width)
+		if err != nil || len(boxes) == 0 || len(boxes) > 2 {
+			return false
+		}
+
+		for _, box := range boxes {
+			if box.MinLong > box.MaxLong || box.MinLong < -180 || box.MaxLong > 180 {
+				return false
+			}
+		}
+
+		// Points too close to an edge depend on rounding, not on the split
+		if math.Abs(v.PointLong-v.Width) < epsilon || v.PointLong < epsilon || 360-v.PointLong < epsilon {
+			return true
+		}
+
+		lat, long := v.PointLat, NormalizeLong(v.MinLong+v.PointLong)
+		want := lat >= v.MinLat && lat <= v.MaxLat && v.PointLong <= v.Width
+
+		got := false
+		for _, box := range boxes {
+			got = got || box.Contains(lat, long)
+		}
+
+		return got == want
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 10_000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSplitBoundsFullTurnCoversEverything(t *testing.T) {
+	property := func(v viewport) bool {
+		boxes, err := SplitBounds(v.MinLat, v.MinLong, v.MaxLat, v.MinLong+360+v.Width)
+		if err != nil || len(boxes) != 1 {
+			return false
+		}
+		return boxes[0].MinLong == -180 && boxes[0].MaxLong == 180
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSplitBoundsRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name                             string
+		minLat, minLong, maxLat, maxLong float64
+	}{
+		{"NaN latitude", math.NaN(), 0, 10, 10},
+		{"infinite longitude", 0, math.Inf(-1), 10, 10},
+		{"inverted latitudes", 20, 0, 10, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SplitBounds(tt.minLat, tt.minLong, tt.maxLat, tt.maxLong); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestNormalizeLong(t *testing.T) {
+	property := func(long float64) bool {
+		normalized := NormalizeLong(long)
+		return normalized >= -180 && normalized < 180 && NormalizeLong(normalized) == normalized
+	}
+
+	values := func(args []reflect.Value, r *rand.Rand) {
+		args[0] = reflect.ValueOf((r.Float64()*2 - 1) * math.Pow(10, float64(r.Intn(7))))
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 10_000, Values: values}); err != nil {
+		t.Error(err)
+	}
+
+	for _, long := range []float64{-540, -180, 180, 540} {
+		if got := NormalizeLong(long); got != -180 {
+			t.Errorf("NormalizeLong(%v) = %v, want -180", long, got)
+		}
+	}
+}
+
+func TestClampLat(t *testing.T) {
+	property := func(lat float64) bool {
+		clamped := ClampLat(lat)
+		if lat >= -90 && lat <= 90 {
+			return clamped == lat
+		}
+		return clamped >= -90 && clamped <= 90
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,83 @@
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+// metersPerDegreeLat is the length of one degree of latitude, which is close
+// enough to constant for snapping purposes.
+const metersPerDegreeLat = 111_320.0
+
+var ErrInvalidPrecision = errors.New("precision must be one of exact, 100m, 1km or city")
+
+// Precision is how coarsely a location is stored before it is shown to other
+// users.
+type Precision string
+
+const (
+	PrecisionExact Precision = "exact"
+	Precision100m  Precision = "100m"
+	Precision1km   Precision = "1km"
+	PrecisionCity  Precision = "city"
+)
+
+// ParsePrecision validates a precision coming from user input.
+func ParsePrecision(s string) (Precision, error) {
+	switch p := Precision(s); p {
+	case PrecisionExact, Precision100m, Precision1km, PrecisionCity:
+		return p, nil
+	}
+
+	return "", ErrInvalidPrecision
+}
+
+// GridSize returns the cell size in meters, or 0 for exact locations.
+func (p Precision) GridSize() float64 {
+	switch p {
+	case Precision100m:
+		return 100
+	case Precision1km:
+		return 1_000
+	case PrecisionCity:
+		return 10_000
+	}
+
+	return 0
+}
+
+// Snap moves a point to the center of its grid cell. Snapping rather than
+// adding random jitter means posting repeatedly from the same spot can't be
+// averaged back to the real location.
+//
+// Cells are square in meters, so longitude cells widen towards the poles.
+// They are stretched slightly so that every row divides evenly at the
+// antimeridian.
+func (p Precision) Snap(lat, long float64) (float64, float64) {
+	size := p.GridSize()
+	if size == 0 {
+		return lat, long
+	}
+
+	latStep := size / metersPerDegreeLat
+	lat = ClampLat((math.Floor(lat/latStep) + 0.5) * latStep)
+
+	// Use the snapped latitude so every point in a row shares one grid
+	cos := math.Cos(lat * math.Pi / 180)
+	if cos < 1e-6 {
+		return lat, 0
+	}
+
+	// Round the cells up so a whole number of them fits around the globe,
+	// a partial cell at the antimeridian would have its centre outside it
+	cells := math.Floor(360 / (size / (metersPerDegreeLat * cos)))
+	if cells <= 1 {
+		return lat, 0
+	}
+	longStep := 360 / cells
+
+	cell := math.Min(math.Floor((NormalizeLong(long)+180)/longStep), cells-1)
+	long = (cell+0.5)*longStep - 180
+
+	return lat, long
+}
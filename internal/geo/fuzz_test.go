@@ -0,0 +1,97 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSnapKeepsExactLocations(t *testing.T) {
+	lat, long := PrecisionExact.Snap(51.50073, -0.12463)
+	if lat != 51.50073 || long != -0.12463 {
+		t.Errorf("got %v, %v", lat, long)
+	}
+}
+
+func TestSnap(t *testing.T) {
+	points := []struct {
+		name      string
+		lat, long float64
+	}{
+		{"origin", 0, 0},
+		{"london", 51.50073, -0.12463},
+		{"south of the equator", -33.85678, 151.21530},
+		{"north pole", 90, 12},
+		{"near the north pole", 89.9999, -45},
+		{"south pole", -90, 0},
+		{"near the south pole", -89.9999, 170},
+		{"east of the antimeridian", 10, -180},
+		{"on the antimeridian", 10, 180},
+		{"just west of the antimeridian", 10, 179.9999},
+		{"just east of the antimeridian", -10, -179.9999},
+	}
+
+	for _, precision := range []Precision{Precision100m, Precision1km, PrecisionCity} {
+		size := precision.GridSize()
+
+		for _, p := range points {
+			t.Run(string(precision)+"/"+p.name, func(t *testing.T) {
+				lat, long := precision.Snap(p.lat, p.long)
+
+				if lat < -90 || lat > 90 || long < -180 || long >= 180 {
+					t.Fatalf("snapped out of range to %v, %v", lat, long)
+				}
+
+				// A cell centre is at most half a cell away on each axis
+				if moved := math.Abs(lat-p.lat) * metersPerDegreeLat; moved > size/2+1e-6 {
+					t.Errorf("latitude moved %vm in a %vm grid", moved, size)
+				}
+
+				// Longitude cells are stretched to fit evenly around the
+				// globe, by less than double
+				cos := math.Cos(lat * math.Pi / 180)
+				if cells := math.Floor(360 / (size / (metersPerDegreeLat * cos))); cells > 1 {
+					step := 360 / cells
+					if step*metersPerDegreeLat*cos >= 2*size {
+						t.Errorf("%v° cells in a %vm grid", step, size)
+					}
+
+					dLong := math.Abs(NormalizeLong(long - p.long))
+					if dLong > step/2+1e-9 {
+						t.Errorf("longitude moved %v° in %v° cells", dLong, step)
+					}
+				} else if long != 0 {
+					t.Errorf("expected one cell at the pole, got longitude %v", long)
+				}
+
+				// Every point of a cell snaps to its centre, including the
+				// centre itself
+				if lat2, long2 := precision.Snap(lat, long); math.Abs(lat2-lat) > 1e-9 || math.Abs(long2-long) > 1e-9 {
+					t.Errorf("centre %v, %v snapped again to %v, %v", lat, long, lat2, long2)
+				}
+			})
+		}
+	}
+}
+
+func TestSnapAntimeridianIsOneMeridian(t *testing.T) {
+	for _, precision := range []Precision{Precision100m, Precision1km, PrecisionCity} {
+		lat1, long1 := precision.Snap(10, 180)
+		lat2, long2 := precision.Snap(10, -180)
+		if lat1 != lat2 || long1 != long2 {
+			t.Errorf("%s: 180 snapped to %v, %v but -180 to %v, %v", precision, lat1, long1, lat2, long2)
+		}
+	}
+}
+
+func TestSnapSharesCells(t *testing.T) {
+	for _, precision := range []Precision{Precision100m, Precision1km, PrecisionCity} {
+		// Two points a few meters apart in the middle of a cell
+		lat, long := precision.Snap(48.85837, 2.29448)
+		offset := precision.GridSize() / 10 / metersPerDegreeLat
+
+		lat2, long2 := precision.Snap(lat+offset, long-offset)
+		if lat2 != lat || long2 != long {
+			t.Errorf("%s: nearby points snapped to %v, %v and %v, %v", precision, lat, long, lat2, long2)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const earthRadiusKm = 6371.0
+
+// Place is a named populated place from the cities dataset.
+type Place struct {
+	Name        string  `json:"name"`
+	CountryCode string  `json:"country_code"`
+	Lat         float64 `json:"lat"`
+	Long        float64 `json:"long"`
+}
+
+// Geocoder resolves coordinates to the nearest known place entirely in
+// memory. Places are stored as points on the unit sphere in a k-d tree, so
+// lookups are fast and work across the antimeridian and near the poles.
+type Geocoder struct {
+	nodes []kdNode
+}
+
+type kdNode struct {
+	point [3]float64
+	place Place
+}
+
+// LoadCities reads a GeoNames style, tab separated cities dump such as
+// cities1000.txt. Only the name (column 2), latitude (5), longitude (6) and
+// country code (9) are used; lines that can't be parsed are skipped.
+func LoadCities(path string) (*Geocoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var places []Place
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 9 {
+			continue
+		}
+
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			continue
+		}
+
+		long, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			continue
+		}
+
+		places = append(places, Place{
+			Name:        fields[1],
+			CountryCode: fields[8],
+			Lat:         lat,
+			Long:        long,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(places) == 0 {
+		return nil, fmt.Errorf("no places found in %s", path)
+	}
+
+	return NewGeocoder(places), nil
+}
+
+// NewGeocoder builds a geocoder over the given places.
+func NewGeocoder(places []Place) *Geocoder {
+	nodes := make([]kdNode, len(places))
+	for i, place := range places {
+		nodes[i] = kdNode{point: toUnitVector(place.Lat, place.Long), place: place}
+	}
+
+	build(nodes, 0)
+
+	return &Geocoder{nodes: nodes}
+}
+
+// Len returns the number of places loaded.
+func (g *Geocoder) Len() int {
+	return len(g.nodes)
+}
+
+// Nearest returns the closest place to the point and its great-circle
+// distance in km. ok is false when the geocoder holds no places.
+func (g *Geocoder) Nearest(lat, long float64) (place Place, distanceKm float64, ok bool) {
+	if g == nil || len(g.nodes) == 0 {
+		return Place{}, 0, false
+	}
+
+	target := toUnitVector(lat, long)
+	best := -1
+	bestDist := math.Inf(1)
+
+	g.search(g.nodes, 0, 0, target, &best, &bestDist)
+
+	// Convert the squared chord length back to an arc on the earth
+	chord := math.Sqrt(bestDist)
+	distanceKm = 2 * earthRadiusKm * math.Asin(math.Min(1, chord/2))
+
+	return g.nodes[best].place, distanceKm, true
+}
+
+// build arranges nodes in place as an implicit k-d tree: the median of each
+// slice is its root and the halves on either side are its subtrees.
+func build(nodes []kdNode, depth int) {
+	if len(nodes) <= 1 {
+		return
+	}
+
+	axis := depth % 3
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].point[axis] < nodes[j].point[axis]
+	})
+
+	mid := len(nodes) / 2
+	build(nodes[:mid], depth+1)
+	build(nodes[mid+1:], depth+1)
+}
+
+func (g *Geocoder) search(nodes []kdNode, offset int, depth int, target [3]float64, best *int, bestDist *float64) {
+	if len(nodes) == 0 {
+		return
+	}
+
+	mid := len(nodes) / 2
+	node := nodes[mid]
+
+	if d := squaredDistance(node.point, target); d < *bestDist {
+		*bestDist = d
+		*best = offset + mid
+	}
+
+	axis := depth % 3
+	diff := target[axis] - node.point[axis]
+
+	near, nearOffset := nodes[:mid], offset
+	far, farOffset := nodes[mid+1:], offset+mid+1
+	if diff > 0 {
+		near, nearOffset, far, farOffset = far, farOffset, near, nearOffset
+	}
+
+	g.search(near, nearOffset, depth+1, target, best, bestDist)
+
+	// Only visit the other side if the splitting plane is closer than the
+	// best match so far
+	if diff*diff < *bestDist {
+		g.search(far, farOffset, depth+1, target, best, bestDist)
+	}
+}
+
+func toUnitVector(lat, long float64) [3]float64 {
+	latRad := lat * math.Pi / 180
+	longRad := long * math.Pi / 180
+
+	return [3]float64{
+		math.Cos(latRad) * math.Cos(longRad),
+		math.Cos(latRad) * math.Sin(longRad),
+		math.Sin(latRad),
+	}
+}
+
+func squaredDistance(a, b [3]float64) float64 {
+	dx := a[0] - b[0]
+	dy := a[1] - b[1]
+	dz := a[2] - b[2]
+
+	return dx*dx + dy*dy + dz*dz
+}
@@ -0,0 +1,133 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// randomPlaces scatters places over the globe, with extra ones crowded
+// around the poles and the antimeridian.
+func randomPlaces(r *rand.Rand, n int) []Place {
+	places := make([]Place, 0, n)
+	for i := range n {
+		var lat, long float64
+		switch i % 4 {
+		case 0:
+			lat, long = 85+r.Float64()*5, r.Float64()*360-180
+		case 1:
+			lat, long = -90+r.Float64()*5, r.Float64()*360-180
+		case 2:
+			lat, long = r.Float64()*180-90, 175+r.Float64()*10
+		default:
+			lat, long = math.Asin(r.Float64()*2-1)*180/math.Pi, r.Float64()*360-180
+		}
+		places = append(places, Place{Lat: lat, Long: NormalizeLong(long)})
+	}
+	return places
+}
+
+func TestNearestMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	places := randomPlaces(r, 5_000)
+	geocoder := NewGeocoder(places)
+
+	targets := []Point{
+		{90, 0}, {-90, 0}, {89.999, 179.999}, {-89.999, -179.999},
+		{0, 180}, {0, -180}, {45, 179.9999}, {-45, -179.9999},
+	}
+	for range 2_000 {
+		targets = append(targets, Point{r.Float64()*180 - 90, r.Float64()*360 - 180})
+	}
+
+	for _, target := range targets {
+		wantKm := math.Inf(1)
+		for _, place := range places {
+			wantKm = math.Min(wantKm, DistanceKm(target.Lat, target.Long, place.Lat, place.Long))
+		}
+
+		place, gotKm, ok := geocoder.Nearest(target.Lat, target.Long)
+		if !ok {
+			t.Fatal("no place found")
+		}
+
+		// Ties can pick either place, but never one further away
+		if placeKm := DistanceKm(target.Lat, target.Long, place.Lat, place.Long); math.Abs(placeKm-wantKm) > 1e-6 {
+			t.Fatalf("%+v: got %+v %g km away, nearest is %g km away", target, place, placeKm, wantKm)
+		}
+		if math.Abs(gotKm-wantKm) > 1e-6 {
+			t.Errorf("%+v: reported %g km, want %g km", target, gotKm, wantKm)
+		}
+	}
+}
+
+func TestNearestAcrossTheAntimeridian(t *testing.T) {
+	geocoder := NewGeocoder([]Place{
+		{Name: "Suva", Lat: -18.14, Long: 178.44},
+		{Name: "Apia", Lat: -13.83, Long: -171.76},
+		{Name: "Nuku'alofa", Lat: -21.14, Long: -175.2},
+	})
+
+	place, _, _ := geocoder.Nearest(-18, -179.9)
+	if place.Name != "Suva" {
+		t.Errorf("got %s", place.Name)
+	}
+}
+
+func TestNearestWithoutPlaces(t *testing.T) {
+	var geocoder *Geocoder
+	if _, _, ok := geocoder.Nearest(0, 0); ok {
+		t.Error("expected no place from a nil geocoder")
+	}
+
+	if _, _, ok := NewGeocoder(nil).Nearest(0, 0); ok {
+		t.Error("expected no place from an empty geocoder")
+	}
+}
+
+func TestLoadCities(t *testing.T) {
+	// Lines in the GeoNames format: id, name, ascii name, alternate names,
+	// lat, long, feature class and code, country code and more
+	data := "2643743\tLondon\tLondon\tLondres,Londra\t51.50853\t-0.12574\tP\tPPLC\tGB\t\tENG\t\t\t\t8961989\t\t25\tEurope/London\t2023-01-01\n" +
+		"2988507\tParis\tParis\tParigi\t48.85341\t2.3488\tP\tPPLC\tFR\t\t11\t75\t751\t75056\t2138551\t\t42\tEurope/Paris\t2023-01-01\n" +
+		"1\tNowhere\tNowhere\t\tnorth\t2.3488\tP\tPPL\tFR\n" +
+		"too\tshort\n" +
+		"\n"
+
+	path := filepath.Join(t.TempDir(), "cities.txt")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	geocoder, err := LoadCities(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if geocoder.Len() != 2 {
+		t.Fatalf("loaded %d places, want 2", geocoder.Len())
+	}
+
+	place, _, _ := geocoder.Nearest(51.5, -0.1)
+	want := Place{Name: "London", CountryCode: "GB", Lat: 51.50853, Long: -0.12574}
+	if place != want {
+		t.Errorf("got %+v, want %+v", place, want)
+	}
+}
+
+func TestLoadCitiesRejectsEmptyDatasets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cities.txt")
+	if err := os.WriteFile(path, []byte("not\ta\tcities\tfile\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadCities(path); err == nil {
+		t.Error("expected an error for a file without places")
+	}
+
+	if _, err := LoadCities(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,86 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Feature is a single GeoJSON feature reduced to the geometries zones can
+// use: a Point or the outer ring of a Polygon. Exactly one of Point and
+// Polygon is set.
+type Feature struct {
+	Point      *Point
+	Polygon    Polygon
+	Properties json.RawMessage
+}
+
+type geoJSONFeature struct {
+	Type     string `json:"type"`
+	Geometry *struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+// ParseFeatureCollection reads a GeoJSON FeatureCollection. GeoJSON orders
+// positions as [longitude, latitude]; the returned points use named fields
+// so the order can't be mixed up later.
+func ParseFeatureCollection(data []byte) ([]Feature, error) {
+	var collection struct {
+		Type     string           `json:"type"`
+		Features []geoJSONFeature `json:"features"`
+	}
+
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	if collection.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a FeatureCollection, got %q", collection.Type)
+	}
+
+	features := make([]Feature, 0, len(collection.Features))
+
+	for i, f := range collection.Features {
+		if f.Type != "Feature" || f.Geometry == nil {
+			return nil, fmt.Errorf("feature %d: expected a Feature with a geometry", i)
+		}
+
+		feature := Feature{Properties: f.Properties}
+
+		switch f.Geometry.Type {
+		case "Point":
+			var position []float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &position); err != nil || len(position) < 2 {
+				return nil, fmt.Errorf("feature %d: invalid Point coordinates", i)
+			}
+			feature.Point = &Point{Lat: position[1], Long: position[0]}
+
+		case "Polygon":
+			var rings [][][]float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &rings); err != nil || len(rings) == 0 {
+				return nil, fmt.Errorf("feature %d: invalid Polygon coordinates", i)
+			}
+
+			for _, position := range rings[0] {
+				if len(position) < 2 {
+					return nil, fmt.Errorf("feature %d: invalid Polygon position", i)
+				}
+				feature.Polygon = append(feature.Polygon, Point{Lat: position[1], Long: position[0]})
+			}
+
+			// GeoJSON rings repeat the first position at the end
+			if n := len(feature.Polygon); n > 1 && feature.Polygon[0] == feature.Polygon[n-1] {
+				feature.Polygon = feature.Polygon[:n-1]
+			}
+
+		default:
+			return nil, fmt.Errorf("feature %d: unsupported geometry type %q", i, f.Geometry.Type)
+		}
+
+		features = append(features, feature)
+	}
+
+	return features, nil
+}
@@ -0,0 +1,100 @@
+package geo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFeatureCollection(t *testing.T) {
+	data := `{
+		"type": "FeatureCollection",
+		"features": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-0.12, 51.5, 11]}, "properties": {"radius_km": 2}},
+			{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [
+				[[2.2, 48.8], [2.4, 48.8], [2.4, 48.9], [2.2, 48.9], [2.2, 48.8]],
+				[[2.3, 48.85], [2.31, 48.85], [2.31, 48.86], [2.3, 48.85]]
+			]}, "properties": null}
+		]
+	}`
+
+	features, err := ParseFeatureCollection([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(features) != 2 {
+		t.Fatalf("got %d features", len(features))
+	}
+
+	// Positions are longitude first, and the altitude is ignored
+	if point := features[0].Point; point == nil || point.Lat != 51.5 || point.Long != -0.12 || features[0].Polygon != nil {
+		t.Errorf("unexpected point feature %+v", features[0])
+	}
+	if string(features[0].Properties) != `{"radius_km": 2}` {
+		t.Errorf("unexpected properties %s", features[0].Properties)
+	}
+
+	// Only the outer ring is kept, without the repeated closing position
+	want := Polygon{{48.8, 2.2}, {48.8, 2.4}, {48.9, 2.4}, {48.9, 2.2}}
+	polygon := features[1].Polygon
+	if features[1].Point != nil || len(polygon) != len(want) {
+		t.Fatalf("unexpected polygon feature %+v", features[1])
+	}
+	for i := range want {
+		if polygon[i] != want[i] {
+			t.Errorf("got %+v, want %+v", polygon, want)
+			break
+		}
+	}
+}
+
+func TestParseFeatureCollectionKeepsOpenRings(t *testing.T) {
+	data := `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [10, 0], [10, 10]]]}}
+	]}`
+
+	features, err := ParseFeatureCollection([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(features[0].Polygon) != 3 {
+		t.Errorf("got %+v", features[0].Polygon)
+	}
+}
+
+func TestParseFeatureCollectionRejectsInvalidGeoJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		message string
+	}{
+		{"not JSON", `{"type": `, "invalid GeoJSON"},
+		{"single feature", `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [0, 0]}}`, "expected a FeatureCollection"},
+		{"feature of the wrong type", `{"type": "FeatureCollection", "features": [{"type": "Point", "coordinates": [0, 0]}]}`, "feature 0: expected a Feature"},
+		{"feature without geometry", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": null}]}`, "feature 0: expected a Feature"},
+		{"point with one coordinate", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Point", "coordinates": [1]}}]}`, "invalid Point coordinates"},
+		{"point with text coordinates", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Point", "coordinates": ["1", "2"]}}]}`, "invalid Point coordinates"},
+		{"polygon without rings", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": []}}]}`, "invalid Polygon coordinates"},
+		{"polygon given as a point", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [0, 0]}}]}`, "invalid Polygon coordinates"},
+		{"polygon with a short position", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1], [1, 1]]]}}]}`, "invalid Polygon position"},
+		{"line string", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[0, 0], [1, 1]]}}]}`, `unsupported geometry type "LineString"`},
+		{"multi polygon", `{"type": "FeatureCollection", "features": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [0, 0]}},
+			{"type": "Feature", "geometry": {"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1]]]]}}
+		]}`, `feature 1: unsupported geometry type "MultiPolygon"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			features, err := ParseFeatureCollection([]byte(tt.data))
+			if err == nil {
+				t.Fatalf("expected an error, got %+v", features)
+			}
+
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("got %q, want it to mention %q", err, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package geo
+
+import (
+	"math"
+)
+
+type Point struct {
+	Lat  float64 `json:"lat"`
+	Long float64 `json:"long"`
+}
+
+// DistanceKm returns the great-circle distance between two points using the
+// haversine formula.
+func DistanceKm(lat1, long1, lat2, long2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLong := (long2 - long1) * toRad
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLong/2)*math.Sin(dLong/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// CircleBounds returns a box containing every point within radiusKm of the
+// center. Circles that reach a pole or cross the antimeridian get the full
+// longitude range, which is wider than needed but never misses a point.
+func CircleBounds(lat, long, radiusKm float64) BoundingBox {
+	// Degrees on the sphere DistanceKm measures on, a box from the slightly
+	// longer metersPerDegreeLat would cut off the edge of the circle
+	kmPerDegree := earthRadiusKm * math.Pi / 180
+	latDelta := radiusKm / kmPerDegree
+
+	box := BoundingBox{
+		MinLat:  lat - latDelta,
+		MaxLat:  lat + latDelta,
+		MinLong: -180,
+		MaxLong: 180,
+	}
+
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat = ClampLat(box.MinLat)
+		box.MaxLat = ClampLat(box.MaxLat)
+		return box
+	}
+
+	// Use the latitude furthest from the equator, where degrees of
+	// longitude are shortest
+	widest := math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat))
+	longDelta := radiusKm / (kmPerDegree * math.Cos(widest*math.Pi/180))
+
+	if long-longDelta >= -180 && long+longDelta <= 180 {
+		box.MinLong = long - longDelta
+		box.MaxLong = long + longDelta
+	}
+
+	return box
+}
+
+// Polygon is a closed ring of points; the last point connects back to the
+// first. Edges are treated as straight lines in lat/long space, which is
+// accurate enough for zones a few km across.
+//
+// An edge always takes the way that stays within -180 to 180, so a polygon
+// can't cross the antimeridian; see CrossesAntimeridian.
+type Polygon []Point
+
+// Contains reports whether the point is inside the polygon using ray
+// casting. Points on the southern and western edges are inside and those on
+// the northern and eastern edges outside, so a point on the edge two
+// polygons share is in exactly one of them.
+func (p Polygon) Contains(lat, long float64) bool {
+	inside := false
+
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		a, b := p[i], p[j]
+
+		if (a.Lat > lat) != (b.Lat > lat) &&
+			long < (b.Long-a.Long)*(lat-a.Lat)/(b.Lat-a.Lat)+a.Long {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// CrossesAntimeridian reports whether any edge spans more than half the
+// globe, which for a polygon drawn on a map means it was meant to go the
+// short way across the antimeridian.
+func (p Polygon) CrossesAntimeridian() bool {
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		if math.Abs(p[i].Long-p[j].Long) > 180 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bounds returns the smallest box containing the polygon.
+func (p Polygon) Bounds() BoundingBox {
+	box := BoundingBox{
+		MinLat:  math.Inf(1),
+		MinLong: math.Inf(1),
+		MaxLat:  math.Inf(-1),
+		MaxLong: math.Inf(-1),
+	}
+
+	for _, point := range p {
+		box.MinLat = math.Min(box.MinLat, point.Lat)
+		box.MaxLat = math.Max(box.MaxLat, point.Lat)
+		box.MinLong = math.Min(box.MinLong, point.Long)
+		box.MaxLong = math.Max(box.MaxLong, point.Long)
+	}
+
+	return box
+}
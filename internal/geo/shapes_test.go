@@ -0,0 +1,124 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// destination walks distanceKm from a point along bearing, in degrees
+// clockwise from north.
+func destination(lat, long, bearing, distanceKm float64) (float64, float64) {
+	toRad := math.Pi / 180
+	phi, lambda, theta := lat*toRad, long*toRad, bearing*toRad
+	delta := distanceKm / earthRadiusKm
+
+	phi2 := math.Asin(math.Sin(phi)*math.Cos(delta) + math.Cos(phi)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi), math.Cos(delta)-math.Sin(phi)*math.Sin(phi2))
+
+	return phi2 / toRad, NormalizeLong(lambda2 / toRad)
+}
+
+func TestCircleBoundsContainsCircle(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for range 100_000 {
+		lat, long := r.Float64()*170-85, r.Float64()*360-180
+		radiusKm := math.Pow(10, r.Float64()*5-3)
+		box := CircleBounds(lat, long, radiusKm)
+
+		// Points just inside the edge are the furthest from the center
+		pointLat, pointLong := destination(lat, long, r.Float64()*360, radiusKm*(1-1e-9))
+
+		if !box.Contains(pointLat, pointLong) {
+			t.Fatalf("%v is %g km from %v, outside %+v", []float64{pointLat, pointLong}, radiusKm, []float64{lat, long}, box)
+		}
+	}
+}
+
+func TestPolygonContains(t *testing.T) {
+	square := Polygon{{0, 0}, {0, 10}, {10, 10}, {10, 0}}
+	// Vertices on the same latitude as the test points
+	diamond := Polygon{{0, 5}, {5, 10}, {10, 5}, {5, 0}}
+	// A U open to the north, the notch is between longitudes 3 and 7
+	u := Polygon{{0, 0}, {0, 10}, {10, 10}, {10, 7}, {3, 7}, {3, 3}, {10, 3}, {10, 0}}
+
+	tests := []struct {
+		name      string
+		polygon   Polygon
+		lat, long float64
+		want      bool
+	}{
+		{"inside", square, 5, 5, true},
+		{"outside", square, 15, 5, false},
+		{"west of", square, 5, -5, false},
+		{"east of", square, 5, 15, false},
+		{"south west vertex", square, 0, 0, true},
+		{"north east vertex", square, 10, 10, false},
+		{"south edge", square, 0, 5, true},
+		{"west edge", square, 5, 0, true},
+		{"north edge", square, 10, 5, false},
+		{"east edge", square, 5, 10, false},
+		{"ray through two vertices", diamond, 5, -1, false},
+		{"level with the side vertices", diamond, 5, 5, true},
+		{"level with the top vertex", diamond, 10, 0, false},
+		{"outside a corner", diamond, 1, 1, false},
+		{"inside near a vertex", diamond, 9, 5, true},
+		{"left arm", u, 8, 1, true},
+		{"right arm", u, 8, 9, true},
+		{"base", u, 1, 5, true},
+		{"notch", u, 8, 5, false},
+		{"level with the notch floor", u, 3, 1, true},
+		{"notch floor, a northern edge", u, 3, 5, false},
+		{"above the notch", u, 12, 5, false},
+		{"empty", Polygon{}, 0, 0, false},
+		{"line", Polygon{{0, 0}, {10, 10}}, 5, 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.polygon.Contains(tt.lat, tt.long); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdjacentPolygonsShareNoPoints(t *testing.T) {
+	west := Polygon{{0, 0}, {0, 10}, {10, 10}, {10, 0}}
+	east := Polygon{{0, 10}, {0, 20}, {10, 20}, {10, 10}}
+	north := Polygon{{10, 0}, {10, 10}, {20, 10}, {20, 0}}
+	northEast := Polygon{{10, 10}, {10, 20}, {20, 20}, {20, 10}}
+
+	for _, point := range []Point{{5, 10}, {0, 10}, {10, 10}, {10, 5}, {10, 0}} {
+		count := 0
+		for _, polygon := range []Polygon{west, east, north, northEast} {
+			if polygon.Contains(point.Lat, point.Long) {
+				count++
+			}
+		}
+
+		if count != 1 {
+			t.Errorf("%+v is in %d polygons", point, count)
+		}
+	}
+}
+
+func TestPolygonCrossesAntimeridian(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon Polygon
+		want    bool
+	}{
+		{"small", Polygon{{0, 0}, {0, 10}, {10, 10}}, false},
+		{"up to the antimeridian", Polygon{{0, 170}, {0, 180}, {10, 180}, {10, 170}}, false},
+		{"across the antimeridian", Polygon{{0, 170}, {0, -170}, {10, -170}, {10, 170}}, true},
+		{"closing edge across the antimeridian", Polygon{{0, -175}, {5, -178}, {10, 179}}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.polygon.CrossesAntimeridian(); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,43 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrNoRecord     = errors.New("models: no matching record found")
 	ErrTooManyItems = errors.New("too many items in result set")
 	ErrTextTooLong  = errors.New("text is too long")
-)
\ No newline at end of file
+	ErrThreadLocked = errors.New("thread is locked")
+)
+
+const (
+	ThreadLimitSpacing = "spacing"
+	ThreadLimitUser    = "user_limit"
+	ThreadLimitZone    = "zone_limit"
+)
+
+// ThreadLimitError is returned when a new thread would break one of the
+// thread limits. Message keeps the wording clients already match on.
+type ThreadLimitError struct {
+	Reason       string  `json:"reason"`
+	Message      string  `json:"-"`
+	MinSpacingKm float64 `json:"min_spacing_km,omitempty"`
+	Limit        int     `json:"limit,omitempty"`
+	Zone         string  `json:"zone,omitempty"`
+}
+
+func (e *ThreadLimitError) Error() string {
+	return e.Message
+}
+
+// SlowModeError is returned when a user posts in a slow mode thread before
+// their cooldown is over.
+type SlowModeError struct {
+	Remaining time.Duration
+}
+
+func (e *SlowModeError) Error() string {
+	return "slow mode is on"
+}
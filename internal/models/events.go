@@ -0,0 +1,215 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"globechat.live/internal/geo"
+)
+
+// Event is the schedule attached to an event thread. Times are stored in
+// UTC, Timezone is the zone the organiser picked and is used for display.
+type Event struct {
+	ThreadId  int       `json:"thread_id"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Timezone  string    `json:"timezone"`
+	Ended     bool      `json:"ended"`
+	RSVPCount int       `json:"rsvp_count"`
+}
+
+type UpcomingEvent struct {
+	Thread *Thread `json:"thread"`
+	Event  Event   `json:"event"`
+}
+
+type RSVP struct {
+	UserId    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	UserImage string    `json:"user_image"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UpcomingQuery struct {
+	Boxes []geo.BoundingBox
+	// Only events starting before this time, ignored when zero
+	Before time.Time
+	Limit  int
+}
+
+type EventModel struct {
+	DB *sql.DB
+}
+
+const eventColumns = `events.thread_id, events.starts_at, events.ends_at, events.timezone, events.ended,
+	(SELECT COUNT(*) FROM event_rsvps WHERE event_rsvps.thread_id = events.thread_id)`
+
+func (m *EventModel) Create(event Event) (Event, error) {
+	stmt := "INSERT INTO events (thread_id, starts_at, ends_at, timezone) VALUES($1, $2, $3, $4)"
+
+	_, err := m.DB.Exec(stmt, event.ThreadId, event.StartsAt.UTC(), event.EndsAt.UTC(), event.Timezone)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return m.GetByThreadId(event.ThreadId)
+}
+
+func (m *EventModel) GetByThreadId(threadId int) (Event, error) {
+	stmt := `SELECT ` + eventColumns + ` FROM events WHERE thread_id = $1`
+
+	var event Event
+	err := m.DB.QueryRow(stmt, threadId).Scan(&event.ThreadId, &event.StartsAt, &event.EndsAt, &event.Timezone, &event.Ended, &event.RSVPCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Event{}, ErrNoRecord
+		}
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+// GetUpcoming returns the events that haven't ended yet, including those in
+// progress, soonest first.
+func (m *EventModel) GetUpcoming(query UpcomingQuery) ([]UpcomingEvent, error) {
+	conditions := []string{"NOT events.ended", "events.ends_at > now()", "NOT threads.held_for_review", "NOT threads.shadow_hidden", "threads.deleted_at IS NULL"}
+	var args []interface{}
+	argIndex := 1
+
+	if len(query.Boxes) > 0 {
+		where, boxArgs := boundsCondition(query.Boxes, argIndex)
+		conditions = append(conditions, where)
+		args = append(args, boxArgs...)
+		argIndex += len(boxArgs)
+	}
+
+	if !query.Before.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("events.starts_at < $%d", argIndex))
+		args = append(args, query.Before)
+		argIndex++
+	}
+
+	stmt := `SELECT ` + threadColumns + `, ` + eventColumns + `
+	         FROM events
+	         INNER JOIN threads ON threads.id = events.thread_id
+	         INNER JOIN users ON users.id = threads.user_id
+	         WHERE ` + strings.Join(conditions, " AND ") +
+		fmt.Sprintf(" ORDER BY events.starts_at ASC LIMIT $%d", argIndex)
+	args = append(args, query.Limit)
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []UpcomingEvent{}
+	for rows.Next() {
+		var e UpcomingEvent
+		e.Thread, err = scanThread(rows, &e.Event.ThreadId, &e.Event.StartsAt, &e.Event.EndsAt, &e.Event.Timezone, &e.Event.Ended, &e.Event.RSVPCount)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// AddRSVP marks the user as going. Answering twice is a no-op.
+func (m *EventModel) AddRSVP(threadId int, userId int) error {
+	stmt := `INSERT INTO event_rsvps (thread_id, user_id) VALUES($1, $2)
+	         ON CONFLICT (thread_id, user_id) DO NOTHING`
+
+	_, err := m.DB.Exec(stmt, threadId, userId)
+	return err
+}
+
+func (m *EventModel) RemoveRSVP(threadId int, userId int) error {
+	stmt := "DELETE FROM event_rsvps WHERE thread_id = $1 AND user_id = $2"
+
+	result, err := m.DB.Exec(stmt, threadId, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *EventModel) GetRSVPs(threadId int) ([]RSVP, error) {
+	stmt := `SELECT event_rsvps.user_id, users.username, users.image, event_rsvps.created_at
+	         FROM event_rsvps
+	         INNER JOIN users ON users.id = event_rsvps.user_id
+	         WHERE event_rsvps.thread_id = $1
+	         ORDER BY event_rsvps.created_at ASC`
+
+	rows, err := m.DB.Query(stmt, threadId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rsvps := []RSVP{}
+	for rows.Next() {
+		var rsvp RSVP
+		err = rows.Scan(&rsvp.UserId, &rsvp.Username, &rsvp.UserImage, &rsvp.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rsvps = append(rsvps, rsvp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rsvps, nil
+}
+
+// EndPast marks every event that finished before now as ended and locks its
+// thread, returning the ids of the threads that were closed.
+func (m *EventModel) EndPast(now time.Time) ([]int, error) {
+	stmt := `WITH ended AS (
+	             UPDATE events SET ended = TRUE
+	             WHERE NOT ended AND ends_at <= $1
+	             RETURNING thread_id
+	         )
+	         UPDATE threads SET locked = TRUE
+	         FROM ended
+	         WHERE threads.id = ended.thread_id AND threads.deleted_at IS NULL
+	         RETURNING threads.id`
+
+	rows, err := m.DB.Query(stmt, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var threadIds []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		threadIds = append(threadIds, id)
+	}
+
+	return threadIds, rows.Err()
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Visibility is who can see a message or thread, filters hide the ones
+// they hold or shadow.
+type Visibility string
+
+const (
+	VisibilityPublic Visibility = "public"
+	// Hidden from everyone but the author until a moderator approves it
+	VisibilityHeld Visibility = "held"
+	// Only ever shown to the author, who isn't told
+	VisibilityShadow Visibility = "shadow"
+)
+
+// What a filter hit was caught in.
+const (
+	FilterTargetMessage = "message"
+	FilterTargetThread  = "thread"
+)
+
+// FilterRule is an admin defined content filter, see the filter package for
+// the kinds, patterns and actions.
+type FilterRule struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	Pattern   string    `json:"pattern"`
+	Action    string    `json:"action"`
+	Enabled   bool      `json:"enabled"`
+	Note      string    `json:"note"`
+	CreatedBy *int      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type FilterHit struct {
+	ID       int    `json:"id"`
+	RuleId   int    `json:"rule_id"`
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+	Target   string `json:"target"`
+	Action   string `json:"action"`
+	// The text as it was submitted, before any masking
+	Text      string    `json:"text"`
+	Matched   string    `json:"matched"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FilterHitQuery struct {
+	// Only hits of this rule, ignored when 0
+	RuleId int
+	Cursor *Cursor
+	Limit  int
+}
+
+type FilterModel struct {
+	DB *sql.DB
+}
+
+const filterRuleColumns = `id, kind, pattern, action, enabled, note, created_by, created_at, updated_at`
+
+func scanFilterRule(row rowScanner) (FilterRule, error) {
+	var rule FilterRule
+	err := row.Scan(&rule.ID, &rule.Kind, &rule.Pattern, &rule.Action, &rule.Enabled, &rule.Note,
+		&rule.CreatedBy, &rule.CreatedAt, &rule.UpdatedAt)
+	return rule, err
+}
+
+func (m *FilterModel) queryRules(stmt string, args ...any) ([]FilterRule, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []FilterRule{}
+	for rows.Next() {
+		rule, err := scanFilterRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (m *FilterModel) GetRules() ([]FilterRule, error) {
+	return m.queryRules("SELECT " + filterRuleColumns + " FROM filter_rules ORDER BY id")
+}
+
+// GetEnabledRules returns the rules the filter chain is built from, in the
+// order they run.
+func (m *FilterModel) GetEnabledRules() ([]FilterRule, error) {
+	return m.queryRules("SELECT " + filterRuleColumns + " FROM filter_rules WHERE enabled ORDER BY id")
+}
+
+func (m *FilterModel) CreateRule(rule FilterRule) (FilterRule, error) {
+	stmt := `INSERT INTO filter_rules (kind, pattern, action, enabled, note, created_by)
+	         VALUES($1, $2, $3, $4, $5, $6)
+	         RETURNING ` + filterRuleColumns
+
+	return scanFilterRule(m.DB.QueryRow(stmt, rule.Kind, rule.Pattern, rule.Action, rule.Enabled, rule.Note, rule.CreatedBy))
+}
+
+func (m *FilterModel) UpdateRule(rule FilterRule) (FilterRule, error) {
+	stmt := `UPDATE filter_rules SET kind = $1, pattern = $2, action = $3, enabled = $4, note = $5, updated_at = NOW()
+	         WHERE id = $6
+	         RETURNING ` + filterRuleColumns
+
+	rule, err := scanFilterRule(m.DB.QueryRow(stmt, rule.Kind, rule.Pattern, rule.Action, rule.Enabled, rule.Note, rule.ID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return FilterRule{}, ErrNoRecord
+		}
+		return FilterRule{}, err
+	}
+
+	return rule, nil
+}
+
+// DeleteRule removes a rule along with its hits.
+func (m *FilterModel) DeleteRule(ruleId int) error {
+	result, err := m.DB.Exec("DELETE FROM filter_rules WHERE id = $1", ruleId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// LogHits stores the hits of a single piece of text in one statement. Hits
+// of rules deleted in the meantime are dropped.
+func (m *FilterModel) LogHits(hits []FilterHit) error {
+	if len(hits) == 0 {
+		return nil
+	}
+
+	ruleIds := make([]int, len(hits))
+	actions := make([]string, len(hits))
+	matched := make([]string, len(hits))
+	for i, hit := range hits {
+		ruleIds[i], actions[i], matched[i] = hit.RuleId, hit.Action, hit.Matched
+	}
+
+	stmt := `INSERT INTO filter_hits (rule_id, user_id, target, action, text, matched)
+	         SELECT hit.rule_id, $4, $5, hit.action, $6, hit.matched
+	         FROM unnest($1::int[], $2::text[], $3::text[]) AS hit(rule_id, action, matched)
+	         WHERE EXISTS (SELECT true FROM filter_rules WHERE filter_rules.id = hit.rule_id)`
+
+	_, err := m.DB.Exec(stmt, pq.Array(ruleIds), pq.Array(actions), pq.Array(matched),
+		hits[0].UserId, hits[0].Target, hits[0].Text)
+	return err
+}
+
+// GetHits returns a page of hits, newest first.
+func (m *FilterModel) GetHits(query FilterHitQuery) ([]FilterHit, Page, error) {
+	var conditions []string
+	var args []any
+
+	if query.RuleId != 0 {
+		args = append(args, query.RuleId)
+		conditions = append(conditions, fmt.Sprintf("filter_hits.rule_id = $%d", len(args)))
+	}
+
+	condition, arg, order := keyset(query.Cursor, "filter_hits.id", len(args)+1)
+	if condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	args = append(args, query.Limit+1)
+	stmt := `SELECT filter_hits.id, filter_hits.rule_id, filter_hits.user_id, users.username, filter_hits.target,
+	                filter_hits.action, filter_hits.text, filter_hits.matched, filter_hits.created_at
+	         FROM filter_hits
+	         INNER JOIN users ON users.id = filter_hits.user_id` +
+		whereClause(conditions) + " ORDER BY " + order + fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	defer rows.Close()
+
+	hits := []FilterHit{}
+	for rows.Next() {
+		var hit FilterHit
+		err = rows.Scan(&hit.ID, &hit.RuleId, &hit.UserId, &hit.Username, &hit.Target,
+			&hit.Action, &hit.Text, &hit.Matched, &hit.CreatedAt)
+		if err != nil {
+			return nil, Page{}, err
+		}
+		hits = append(hits, hit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+
+	hits, page := paginate(hits, query.Limit, query.Cursor, func(hit FilterHit) int { return hit.ID })
+	return hits, page, nil
+}
@@ -0,0 +1,12 @@
+package models
+
+import "hash/fnv"
+
+// advisoryLockKey hashes name into the key space of pg_advisory_xact_lock.
+// Names start with what they lock, like "poll-vote:", so locks of different
+// features never share a key.
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
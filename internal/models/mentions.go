@@ -0,0 +1,148 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// MaxMentions is how many different users a single message can mention.
+const MaxMentions = 10
+
+// Mention is an @username in a message resolved to a user. Offset and
+// Length count UTF-16 code units, the same as JavaScript string indices, and
+// cover the leading @.
+type Mention struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+	UserId int `json:"user_id"`
+}
+
+// A mention starts at the beginning of the text or after a character that
+// can't be part of a name, so e-mail addresses aren't picked up.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])(@[\p{L}\p{N}_.\-]{1,16})`)
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+type mentionToken struct {
+	start, end int // byte offsets
+	username   string
+}
+
+func parseMentions(text string) []mentionToken {
+	var tokens []mentionToken
+
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+
+		// Trailing punctuation ends the sentence rather than the name
+		name := strings.TrimRight(text[start+1:end], ".-")
+		if name == "" {
+			continue
+		}
+
+		tokens = append(tokens, mentionToken{start: start, end: start + 1 + len(name), username: name})
+	}
+
+	return tokens
+}
+
+// resolveMentions finds the users mentioned in text. Names are matched
+// case-insensitively and ones shared by several users are ignored. notify
+// holds the mentioned users who want to be notified.
+func resolveMentions(q queryer, text string) (mentions []Mention, notify []int, err error) {
+	mentions = []Mention{}
+
+	tokens := parseMentions(text)
+	if len(tokens) == 0 {
+		return mentions, nil, nil
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, token := range tokens {
+		name := strings.ToLower(token.username)
+		if !seen[name] && len(names) < MaxMentions {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	stmt := "SELECT id, LOWER(username), mentions_enabled FROM users WHERE LOWER(username) = ANY($1)"
+	rows, err := q.Query(stmt, pq.Array(names))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	type match struct {
+		userId  int
+		enabled bool
+		count   int
+	}
+	matches := make(map[string]*match)
+	for rows.Next() {
+		var userId int
+		var name string
+		var enabled bool
+		if err = rows.Scan(&userId, &name, &enabled); err != nil {
+			return nil, nil, err
+		}
+
+		if m, ok := matches[name]; ok {
+			m.count++
+		} else {
+			matches[name] = &match{userId: userId, enabled: enabled, count: 1}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	notified := make(map[int]bool)
+	for _, token := range tokens {
+		m, ok := matches[strings.ToLower(token.username)]
+		if !ok || m.count > 1 {
+			continue
+		}
+
+		mentions = append(mentions, Mention{
+			Offset: utf16Len(text[:token.start]),
+			Length: utf16Len(text[token.start:token.end]),
+			UserId: m.userId,
+		})
+
+		if m.enabled && !notified[m.userId] {
+			notified[m.userId] = true
+			notify = append(notify, m.userId)
+		}
+	}
+
+	return mentions, notify, nil
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		n += utf16.RuneLen(r)
+		s = s[size:]
+	}
+	return n
+}
+
+// mentionsJSON is how mentions are stored in the messages.mentions column.
+func mentionsJSON(mentions []Mention) ([]byte, error) {
+	if mentions == nil {
+		mentions = []Mention{}
+	}
+	return json.Marshal(mentions)
+}
@@ -2,19 +2,55 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Message struct {
+	ID        int        `json:"id"`
+	Text      string     `json:"text"`
+	Image     string     `json:"image"`
+	Thumbnail string     `json:"thumbnail"`
+	ThreadId  int        `json:"thread_id"`
+	IsFirst   bool       `json:"is_first"`
+	UserId    int        `json:"user_id"`
+	Username  string     `json:"username"`
+	UserImage string     `json:"user_image"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	ReplyToId *int       `json:"reply_to_id"`
+	Mentions  []Mention  `json:"mentions"`
+	// Snapshot of the message this one answers, nil when it isn't a reply
+	ReplyTo *ReplySnapshot `json:"reply_to"`
+	Poll    *Poll          `json:"poll"`
+	// Keyed by emoji
+	Reactions map[string]Reaction `json:"reactions"`
+	// Filled in after the message is created, see message-preview events
+	Previews []LinkPreview `json:"previews"`
+	// Set when the message has been deleted, see Redact
+	Deleted *Tombstone `json:"deleted"`
+	// Caught by a content filter and waiting for a moderator
+	HeldForReview bool `json:"held_for_review"`
+	// Caught by a content filter and only shown to its author, who
+	// mustn't find out
+	ShadowHidden bool `json:"-"`
+}
+
+// Hidden reports whether only the author and moderators can see the message.
+func (message Message) Hidden() bool {
+	return message.HeldForReview || message.ShadowHidden
+}
+
+type MessageRevision struct {
 	ID        int       `json:"id"`
+	MessageId int       `json:"message_id"`
 	Text      string    `json:"text"`
-	Image     string    `json:"image"`
-	ThreadId  int       `json:"thread_id"`
-	IsFirst   bool      `json:"is_first"`
-	UserId    int       `json:"user_id"`
-	Username  string    `json:"username"`
-	UserImage string    `json:"user_image"`
+	EditedBy  int       `json:"edited_by"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -22,28 +58,145 @@ type MessageQuery struct {
 	Search    string
 	PageSize  int
 	PageIndex int
+	// Takes the place of PageIndex when set
+	Cursor *Cursor
 }
 
 type MessageQueryResult struct {
 	Total    int       `json:"total"`
 	Count    int       `json:"count"`
 	Messages []Message `json:"messages"`
+	Page
 }
 
 type MessageModel struct {
 	DB *sql.DB
 }
 
-func (m *MessageModel) Create(text string, image string, threadId int, userId int, isFirst bool) (Message, error) {
+const messageColumns = `messages.id, messages.text, messages.image, messages.thumbnail, messages.thread_id, messages.is_first,
+	messages.user_id, messages.created_at, users.username, users.image, messages.edited_at,
+	messages.reply_to_id, messages.mentions, messages.deleted_at, messages.deleted_by,
+	messages.held_for_review, messages.shadow_hidden`
+
+// visibleMessage selects the messages everyone can see, deleted ones are
+// still shown as tombstones.
+const visibleMessage = "NOT messages.held_for_review AND NOT messages.shadow_hidden"
+
+func scanMessage(row rowScanner) (Message, error) {
+	var message Message
+	var mentions []byte
+	var deletedAt sql.NullTime
+	var deletedBy sql.NullInt64
+	err := row.Scan(&message.ID, &message.Text, &message.Image, &message.Thumbnail, &message.ThreadId, &message.IsFirst,
+		&message.UserId, &message.CreatedAt, &message.Username, &message.UserImage, &message.EditedAt,
+		&message.ReplyToId, &mentions, &deletedAt, &deletedBy,
+		&message.HeldForReview, &message.ShadowHidden)
+	if err != nil {
+		return Message{}, err
+	}
+	message.Deleted = newTombstone(deletedAt, deletedBy, message.UserId)
+
+	err = json.Unmarshal(mentions, &message.Mentions)
+	return message, err
+}
+
+// queryMessages runs stmt and loads the parents, polls, reactions and link
+// previews of the messages, marking viewerId's own reactions.
+func (m *MessageModel) queryMessages(viewerId int, stmt string, args ...any) ([]Message, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = attachReplies(m.DB, messages); err != nil {
+		return nil, err
+	}
+
+	if err = attachMessagePolls(m.DB, messages); err != nil {
+		return nil, err
+	}
+
+	if err = attachReactions(m.DB, messages, viewerId); err != nil {
+		return nil, err
+	}
+
+	if err = attachPreviews(m.DB, messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Create stores a message. upload is its optional image, and replyToId the
+// message it answers; callers check both belong with the message. Hidden
+// messages don't notify anyone or count as replies until they're approved.
+func (m *MessageModel) Create(text string, upload *Upload, threadId int, userId int, isFirst bool, replyToId *int, visibility Visibility, slowMode time.Duration) (Message, error) {
 	if len(text) > 280 {
 		return Message{}, ErrTextTooLong
 	}
-	stmt := "INSERT INTO messages (text, image, thread_id, user_id, is_first) VALUES($1, $2, $3, $4, $5) RETURNING id, text, image, thread_id, is_first, user_id, created_at"
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Message{}, err
+	}
+	defer tx.Rollback()
+
+	if slowMode > 0 {
+		if err = checkSlowMode(tx, threadId, userId, slowMode); err != nil {
+			return Message{}, err
+		}
+	}
+
+	mentions, notify, err := resolveMentions(tx, text)
+	if err != nil {
+		return Message{}, err
+	}
+
+	mentionsData, err := mentionsJSON(mentions)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var uploadId *string
+	var image, thumbnail string
+	if upload != nil {
+		uploadId = &upload.ID
+		image, thumbnail = upload.URL(), upload.ThumbnailURL()
+	}
+
+	stmt := "INSERT INTO messages (text, image, thumbnail, upload_id, thread_id, user_id, is_first, reply_to_id, mentions, held_for_review, shadow_hidden) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id, text, image, thumbnail, thread_id, is_first, user_id, created_at, reply_to_id, held_for_review, shadow_hidden"
 
 	var message Message
-	err := m.DB.QueryRow(stmt, text, image, threadId, userId, isFirst).Scan(&message.ID, &message.Text, &message.Image, &message.ThreadId, &message.IsFirst, &message.UserId, &message.CreatedAt)
+	err = tx.QueryRow(stmt, text, image, thumbnail, uploadId, threadId, userId, isFirst, replyToId, mentionsData, visibility == VisibilityHeld, visibility == VisibilityShadow).Scan(&message.ID, &message.Text, &message.Image, &message.Thumbnail, &message.ThreadId, &message.IsFirst, &message.UserId, &message.CreatedAt, &message.ReplyToId, &message.HeldForReview, &message.ShadowHidden)
 
 	if err != nil {
+		if isUniqueViolation(err, "messages_upload_id_key") {
+			return Message{}, ErrUploadInUse
+		}
+		return Message{}, err
+	}
+	message.Mentions = mentions
+
+	if !message.Hidden() {
+		if err = publishMessage(tx, message, notify); err != nil {
+			return Message{}, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
 		return Message{}, err
 	}
 
@@ -57,30 +210,269 @@ func (m *MessageModel) Create(text string, image string, threadId int, userId in
 	}
 	message.Username = user.Username
 	message.UserImage = user.Image
+	message.Reactions = map[string]Reaction{}
+	message.Previews = []LinkPreview{}
+
+	messages := []Message{message}
+	if err = attachReplies(m.DB, messages); err != nil {
+		return Message{}, err
+	}
+
+	return messages[0], nil
+}
+
+// publishMessage notifies the users a visible message mentions and counts
+// it as a reply to its thread.
+func publishMessage(tx *sql.Tx, message Message, notify []int) error {
+	// Mentioning yourself doesn't notify anyone
+	notify = slices.DeleteFunc(notify, func(id int) bool { return id == message.UserId })
+	if len(notify) > 0 {
+		stmt := `INSERT INTO notifications (user_id, kind, actor_id, thread_id, message_id)
+		        SELECT recipient, $2, $3, $4, $5 FROM unnest($1::int[]) AS recipient
+		        ON CONFLICT (user_id, kind, message_id) DO NOTHING`
+		_, err := tx.Exec(stmt, pq.Array(notify), NotificationMention, message.UserId, message.ThreadId, message.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The first message is the thread itself and isn't counted as a reply
+	stmt := "UPDATE threads SET replies = replies + $1, last_activity_at = GREATEST(last_activity_at, $2) WHERE id = $3"
+	_, err := tx.Exec(stmt, replyCount(message.IsFirst), message.CreatedAt, message.ThreadId)
+	return err
+}
+
+// Approve publishes a message held for review as if it had just been posted.
+func (m *MessageModel) Approve(messageId int) (Message, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Message{}, err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE messages SET held_for_review = FALSE
+	         WHERE id = $1 AND held_for_review AND deleted_at IS NULL
+	         RETURNING text, thread_id, user_id, is_first, created_at, shadow_hidden`
+
+	var message Message
+	var text string
+	err = tx.QueryRow(stmt, messageId).Scan(&text, &message.ThreadId, &message.UserId, &message.IsFirst, &message.CreatedAt, &message.ShadowHidden)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Message{}, ErrNoRecord
+		}
+		return Message{}, err
+	}
+	message.ID = messageId
+
+	if !message.ShadowHidden {
+		_, notify, err := resolveMentions(tx, text)
+		if err != nil {
+			return Message{}, err
+		}
+
+		if err = publishMessage(tx, message, notify); err != nil {
+			return Message{}, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Message{}, err
+	}
+
+	return m.GetByID(messageId)
+}
 
-	return message, nil
+// GetHeldForReview returns the messages waiting for a moderator, oldest
+// first.
+func (m *MessageModel) GetHeldForReview() ([]Message, error) {
+	stmt := "SELECT " + messageColumns + " FROM messages INNER JOIN users ON users.id = messages.user_id WHERE messages.held_for_review AND messages.deleted_at IS NULL ORDER BY messages.id ASC"
+
+	return m.queryMessages(0, stmt)
 }
 
-func (m *MessageModel) Delete(messageId int) error {
-	stmt := "DELETE FROM messages WHERE id = $1"
+// Delete soft deletes a message, leaving a tombstone until PurgeDeleted
+// removes it. deletedBy is the author or the moderator removing it.
+func (m *MessageModel) Delete(messageId int, deletedBy int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE messages SET deleted_at = NOW(), deleted_by = $2
+	         WHERE id = $1 AND deleted_at IS NULL
+	         RETURNING thread_id, is_first, held_for_review OR shadow_hidden`
 
-	result, err := m.DB.Exec(stmt, messageId)
+	var threadId int
+	var isFirst, hidden bool
+	err = tx.QueryRow(stmt, messageId, deletedBy).Scan(&threadId, &isFirst, &hidden)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
 		return err
 	}
 
-	// Check if any rows were affected
-	rowsAffected, err := result.RowsAffected()
+	// Mentions in removed text shouldn't keep pointing people at it
+	if _, err = tx.Exec("DELETE FROM notifications WHERE message_id = $1", messageId); err != nil {
+		return err
+	}
+
+	// Hidden messages were never counted as replies
+	removed := replyCount(isFirst)
+	if hidden {
+		removed = 0
+	}
+
+	if err = updateThreadActivity(tx, threadId, removed); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Purge permanently removes a message, used to undo a failed create.
+func (m *MessageModel) Purge(messageId int) error {
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// If no rows were affected, the message didn't exist
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	stmt := `DELETE FROM messages WHERE id = $1
+	         RETURNING thread_id, is_first, deleted_at IS NOT NULL OR held_for_review OR shadow_hidden`
+
+	var threadId int
+	var isFirst, uncounted bool
+	err = tx.QueryRow(stmt, messageId).Scan(&threadId, &isFirst, &uncounted)
+	if err != nil {
+		// If no rows were returned, the message didn't exist
+		return err
 	}
 
-	return nil
+	// Deleted and hidden messages aren't on the reply count
+	if !uncounted {
+		if err = updateThreadActivity(tx, threadId, replyCount(isFirst)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeleted permanently removes the messages deleted before the cutoff,
+// returning how many there were.
+func (m *MessageModel) PurgeDeleted(before time.Time) (int64, error) {
+	result, err := m.DB.Exec("DELETE FROM messages WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// updateThreadActivity takes removed messages off a thread's reply count and
+// moves its last activity back to the newest remaining message.
+func updateThreadActivity(tx *sql.Tx, threadId int, removed int) error {
+	stmt := `UPDATE threads SET
+	            replies = GREATEST(replies - $1, 0),
+	            last_activity_at = COALESCE(
+	                (SELECT MAX(created_at) FROM messages WHERE thread_id = $2 AND deleted_at IS NULL AND ` + visibleMessage + `),
+	                threads.created_at
+	            )
+	        WHERE id = $2`
+	_, err := tx.Exec(stmt, removed, threadId)
+	return err
+}
+
+// Update replaces the text of a reply, keeping the previous text as a
+// revision. The first message is edited through ThreadModel.Update so it
+// stays in sync with its thread.
+func (m *MessageModel) Update(messageId int, text string, editorId int) (Message, error) {
+	if len(text) > 280 {
+		return Message{}, ErrTextTooLong
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Message{}, err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRow("SELECT text FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", messageId).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Message{}, ErrNoRecord
+		}
+		return Message{}, err
+	}
+
+	stmt := "INSERT INTO message_revisions (message_id, text, edited_by) VALUES($1, $2, $3)"
+	if _, err = tx.Exec(stmt, messageId, previous, editorId); err != nil {
+		return Message{}, err
+	}
+
+	// Offsets moved with the text, new mentions don't notify anyone
+	mentions, _, err := resolveMentions(tx, text)
+	if err != nil {
+		return Message{}, err
+	}
+
+	mentionsData, err := mentionsJSON(mentions)
+	if err != nil {
+		return Message{}, err
+	}
+
+	stmt = "UPDATE messages SET text = $1, mentions = $2, edited_at = NOW() WHERE id = $3"
+	if _, err = tx.Exec(stmt, text, mentionsData, messageId); err != nil {
+		return Message{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Message{}, err
+	}
+
+	return m.GetByID(messageId)
+}
+
+// GetRevisions returns the previous versions of a message, newest first.
+func (m *MessageModel) GetRevisions(messageId int) ([]MessageRevision, error) {
+	stmt := `SELECT id, message_id, text, edited_by, created_at
+	         FROM message_revisions
+	         WHERE message_id = $1
+	         ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, messageId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []MessageRevision{}
+	for rows.Next() {
+		var revision MessageRevision
+		err = rows.Scan(&revision.ID, &revision.MessageId, &revision.Text, &revision.EditedBy, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// replyCount is how much a message changes its thread's reply counter.
+func replyCount(isFirst bool) int {
+	if isFirst {
+		return 0
+	}
+	return 1
 }
 
 func (m *MessageModel) DeleteByThreadID(threadId int) error {
@@ -108,32 +500,63 @@ func (m *MessageModel) DeleteByThreadID(threadId int) error {
 func (m *MessageModel) Exists(id int) (bool, error) {
 	var exists bool
 
-	stmt := "SELECT EXISTS(SELECT true FROM messages WHERE id = $1)"
+	stmt := "SELECT EXISTS(SELECT true FROM messages WHERE id = $1 AND deleted_at IS NULL)"
 
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
 
 	return exists, err
 }
 
+// GetByID returns a message unless it has been deleted.
 func (m *MessageModel) GetByID(messageId int) (Message, error) {
-	stmt := "SELECT messages.id, text, messages.image, thread_id, is_first, user_id, messages.created_at, users.username, users.image FROM messages INNER JOIN users ON users.id = messages.user_id WHERE messages.id = $1"
+	return m.getByID(messageId, false)
+}
 
-	message := Message{}
-	err := m.DB.QueryRow(stmt, messageId).Scan(&message.ID, &message.Text, &message.Image, &message.ThreadId, &message.IsFirst, &message.UserId, &message.CreatedAt, &message.Username, &message.UserImage)
+// GetByIDIncludingDeleted also returns deleted messages, with their
+// original content and a tombstone.
+func (m *MessageModel) GetByIDIncludingDeleted(messageId int) (Message, error) {
+	return m.getByID(messageId, true)
+}
 
+func (m *MessageModel) getByID(messageId int, includeDeleted bool) (Message, error) {
+	stmt := "SELECT " + messageColumns + " FROM messages INNER JOIN users ON users.id = messages.user_id WHERE messages.id = $1"
+	if !includeDeleted {
+		stmt += " AND messages.deleted_at IS NULL"
+	}
+
+	message, err := scanMessage(m.DB.QueryRow(stmt, messageId))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Message{}, ErrNoRecord
+		}
 		return Message{}, err
 	}
 
-	return message, nil
+	messages := []Message{message}
+	if err = attachReplies(m.DB, messages); err != nil {
+		return Message{}, err
+	}
+
+	if err = attachMessagePolls(m.DB, messages); err != nil {
+		return Message{}, err
+	}
+
+	if err = attachReactions(m.DB, messages, 0); err != nil {
+		return Message{}, err
+	}
+
+	if err = attachPreviews(m.DB, messages); err != nil {
+		return Message{}, err
+	}
+
+	return messages[0], nil
 }
 
 func (m *MessageModel) Query(query MessageQuery) (MessageQueryResult, error) {
 	var result MessageQueryResult
 
 	// Base query with JOIN to get user information
-	baseQuery := `SELECT messages.id, text, messages.image, thread_id, is_first, 
-	              user_id, messages.created_at, users.username, users.image 
+	baseQuery := `SELECT ` + messageColumns + `
 	              FROM messages 
 	              INNER JOIN users ON users.id = messages.user_id`
 
@@ -141,157 +564,141 @@ func (m *MessageModel) Query(query MessageQuery) (MessageQueryResult, error) {
 	countQuery := `SELECT COUNT(*) FROM messages 
 	               INNER JOIN users ON users.id = messages.user_id`
 
-	var whereClause string
+	var conditions []string
 	var args []interface{}
 	argIndex := 1
 
 	// Add search condition if provided
 	if query.Search != "" {
-		whereClause = " WHERE LOWER(text) LIKE LOWER($" + fmt.Sprintf("%d", argIndex) + ")"
+		conditions = append(conditions, fmt.Sprintf("LOWER(text) LIKE LOWER($%d)", argIndex))
 		args = append(args, "%"+query.Search+"%")
 		argIndex++
 	}
 
 	// Get total count first
-	countStmt := countQuery + whereClause
+	countStmt := countQuery + whereClause(conditions)
 	err := m.DB.QueryRow(countStmt, args...).Scan(&result.Total)
 	if err != nil {
 		return MessageQueryResult{}, err
 	}
 
-	// Calculate offset for pagination
-	offset := query.PageIndex * query.PageSize
-
-	// Build final query with pagination
-	finalQuery := baseQuery + whereClause + " ORDER BY messages.created_at DESC LIMIT $" +
-		fmt.Sprintf("%d", argIndex) + " OFFSET $" + fmt.Sprintf("%d", argIndex+1)
-
-	args = append(args, query.PageSize, offset)
-
-	// Execute the query
-	rows, err := m.DB.Query(finalQuery, args...)
-	if err != nil {
-		return MessageQueryResult{}, err
+	condition, arg, order := keyset(query.Cursor, "messages.id", argIndex)
+	if condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+		argIndex++
 	}
-	defer rows.Close()
 
-	var messages []Message
+	// Build final query with pagination, one extra row tells if there are more
+	finalQuery := baseQuery + whereClause(conditions) + " ORDER BY " + order + fmt.Sprintf(" LIMIT $%d", argIndex)
+	args = append(args, query.PageSize+1)
 
-	// Scan results
-	for rows.Next() {
-		var message Message
-		err = rows.Scan(&message.ID, &message.Text, &message.Image, &message.ThreadId,
-			&message.IsFirst, &message.UserId,
-			&message.CreatedAt, &message.Username, &message.UserImage)
-		if err != nil {
-			return MessageQueryResult{}, err
-		}
-		messages = append(messages, message)
+	if query.Cursor == nil {
+		finalQuery += fmt.Sprintf(" OFFSET $%d", argIndex+1)
+		args = append(args, query.PageIndex*query.PageSize)
 	}
 
-	if err = rows.Err(); err != nil {
+	// Execute the query
+	messages, err := m.queryMessages(0, finalQuery, args...)
+	if err != nil {
 		return MessageQueryResult{}, err
 	}
 
-	result.Messages = messages
-	result.Count = len(messages)
+	result.Messages, result.Page = paginateFrom(messages, query.PageSize, query.Cursor, query.PageIndex*query.PageSize, idOfMessage)
+	result.Count = len(result.Messages)
 
 	return result, nil
 }
 
-func (m *MessageModel) GetByThreadID(threadId int, limit int) ([]Message, error) {
-	stmt := "SELECT messages.id, text, messages.image, thread_id, is_first, user_id, messages.created_at, users.username, users.image FROM messages INNER JOIN users ON users.id = messages.user_id WHERE thread_id = $1 ORDER BY created_at DESC LIMIT $2"
+func idOfMessage(message Message) int {
+	return message.ID
+}
 
-	rows, err := m.DB.Query(stmt, threadId, limit)
-	if err != nil {
-		return nil, err
+// GetPage returns up to limit messages of a thread, newest first, starting
+// after cursor or from the newest message when it is nil. Hidden messages
+// are only included for their author.
+func (m *MessageModel) GetPage(threadId int, cursor *Cursor, limit int, viewerId int) ([]Message, Page, error) {
+	condition, arg, order := keyset(cursor, "messages.id", 4)
+
+	args := []any{threadId, limit + 1, viewerId}
+	where := "messages.thread_id = $1 AND (" + visibleMessage + " OR messages.user_id = $3)"
+	if condition != "" {
+		where += " AND " + condition
+		args = append(args, arg)
 	}
-	defer rows.Close()
 
-	messages := []Message{}
+	stmt := "SELECT " + messageColumns + " FROM messages INNER JOIN users ON users.id = messages.user_id WHERE " + where + " ORDER BY " + order + " LIMIT $2"
 
-	for rows.Next() {
-		message := Message{}
-		err = rows.Scan(&message.ID, &message.Text, &message.Image, &message.ThreadId, &message.IsFirst, &message.UserId, &message.CreatedAt, &message.Username, &message.UserImage)
-		if err != nil {
-			return nil, err
-		}
-		messages = append(messages, message)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
+	messages, err := m.queryMessages(viewerId, stmt, args...)
+	if err != nil {
+		return nil, Page{}, err
 	}
 
-	return messages, nil
+	messages, page := paginate(messages, limit, cursor, idOfMessage)
+	return messages, page, nil
 }
 
-func (m *MessageModel) GetBeforeID(threadId int, id int, limit int) ([]Message, error) {
-	stmt := "SELECT messages.id, text, messages.image, thread_id, is_first, user_id, messages.created_at, users.username, users.image FROM messages INNER JOIN users ON users.id = messages.user_id WHERE thread_id = $1 AND messages.id < $2 ORDER BY messages.id DESC LIMIT $3"
+// GetAround returns the message with id messageId and the messages around
+// it, about half older and half newer, newest first.
+func (m *MessageModel) GetAround(threadId int, messageId int, limit int, viewerId int) ([]Message, Page, error) {
+	newerLimit := limit / 2
+	olderLimit := limit - newerLimit
 
-	rows, err := m.DB.Query(stmt, threadId, id, limit)
+	// Starting just above the message so it is the first older one
+	older, olderPage, err := m.GetPage(threadId, &Cursor{Before: messageId + 1}, olderLimit, viewerId)
 	if err != nil {
-		return nil, err
+		return nil, Page{}, err
 	}
-	defer rows.Close()
-
-	messages := []Message{}
-
-	for rows.Next() {
-		message := Message{}
-		err = rows.Scan(&message.ID, &message.Text, &message.Image, &message.ThreadId, &message.IsFirst, &message.UserId, &message.CreatedAt, &message.Username, &message.UserImage)
 
+	// With a limit of 1 there is no room for newer messages, so assume
+	// there are some
+	var newer []Message
+	hasNewer := true
+	if newerLimit > 0 {
+		var newerPage Page
+		newer, newerPage, err = m.GetPage(threadId, &Cursor{After: messageId}, newerLimit, viewerId)
 		if err != nil {
-			return nil, err
+			return nil, Page{}, err
 		}
-		messages = append(messages, message)
+		hasNewer = newerPage.Prev != nil
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+	messages := append(newer, older...)
 
-	return messages, nil
+	return messages, newPage(messages, idOfMessage, olderPage.HasMore, hasNewer), nil
 }
 
-func (m *MessageModel) GetAfterID(threadId int, id int, limit int) ([]Message, error) {
-	stmt := "SELECT messages.id, text, messages.image, thread_id, is_first, user_id, messages.created_at, users.username, users.image FROM messages INNER JOIN users ON users.id = messages.user_id WHERE thread_id = $1 AND messages.id > $2 ORDER BY messages.id ASC LIMIT $3"
-
-	rows, err := m.DB.Query(stmt, threadId, id, limit)
-	if err != nil {
-		return nil, err
+// checkSlowMode returns a SlowModeError while the user's last message in
+// the thread is more recent than cooldown. Deleted and hidden messages count
+// too, so deleting a message doesn't skip the cooldown. The lock holds off
+// the user's other messages to the thread until tx ends, so two requests
+// can't both pass the check.
+func checkSlowMode(tx *sql.Tx, threadId int, userId int, cooldown time.Duration) error {
+	lockKey := advisoryLockKey(fmt.Sprintf("slow-mode:%d:%d", threadId, userId))
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lockKey); err != nil {
+		return err
 	}
-	defer rows.Close()
-
-	messages := []Message{}
 
-	for rows.Next() {
-		message := Message{}
-		err = rows.Scan(&message.ID, &message.Text, &message.Image, &message.ThreadId, &message.IsFirst, &message.UserId, &message.CreatedAt, &message.Username, &message.UserImage)
+	// The time left is worked out by the database, whose clock set
+	// created_at, so a skewed app server clock can't shorten the cooldown
+	stmt := `SELECT GREATEST(0, EXTRACT(EPOCH FROM (created_at + $3 * interval '1 second' - now())))
+	         FROM messages
+	         WHERE thread_id = $1 AND user_id = $2
+	         ORDER BY created_at DESC
+	         LIMIT 1`
 
-		if err != nil {
-			return nil, err
+	var seconds float64
+	err := tx.QueryRow(stmt, threadId, userId, cooldown.Seconds()).Scan(&seconds)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
 		}
-		messages = append(messages, message)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return messages, nil
-}
-
-// GetLastCreatedAtByUser returns the created_at of the most recently created message by userId.
-// If the user has no messages, this will return sql.ErrNoRows.
-func (m *MessageModel) GetLastCreatedAtByUser(userId int) (time.Time, error) {
-	stmt := "SELECT created_at FROM messages WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1"
-
-	var createdAt time.Time
-	err := m.DB.QueryRow(stmt, userId).Scan(&createdAt)
-	if err != nil {
-		return time.Time{}, err
+	if remaining := time.Duration(seconds * float64(time.Second)); remaining > 0 {
+		return &SlowModeError{Remaining: remaining}
 	}
 
-	return createdAt, nil
+	return nil
 }
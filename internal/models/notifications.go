@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const NotificationMention = "mention"
+
+type Notification struct {
+	ID          int        `json:"id"`
+	UserId      int        `json:"user_id"`
+	Kind        string     `json:"kind"`
+	ActorId     int        `json:"actor_id"`
+	ActorName   string     `json:"actor_name"`
+	ActorImage  string     `json:"actor_image"`
+	ThreadId    int        `json:"thread_id"`
+	MessageId   int        `json:"message_id"`
+	MessageText string     `json:"message_text"`
+	ReadAt      *time.Time `json:"read_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+const notificationColumns = `notifications.id, notifications.user_id, notifications.kind, notifications.actor_id, users.username, users.image,
+	notifications.thread_id, notifications.message_id, messages.text, notifications.read_at, notifications.created_at`
+
+func (m *NotificationModel) query(stmt string, args ...any) ([]Notification, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		err = rows.Scan(&n.ID, &n.UserId, &n.Kind, &n.ActorId, &n.ActorName, &n.ActorImage,
+			&n.ThreadId, &n.MessageId, &n.MessageText, &n.ReadAt, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		n.MessageText = truncate(n.MessageText, MaxSnapshotLen)
+		notifications = append(notifications, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// GetByUserId returns the user's latest notifications, newest first.
+func (m *NotificationModel) GetByUserId(userId int, limit int) ([]Notification, error) {
+	stmt := `SELECT ` + notificationColumns + `
+	         FROM notifications
+	         INNER JOIN users ON users.id = notifications.actor_id
+	         INNER JOIN messages ON messages.id = notifications.message_id
+	         WHERE notifications.user_id = $1
+	         ORDER BY notifications.id DESC
+	         LIMIT $2`
+
+	return m.query(stmt, userId, limit)
+}
+
+// GetForMessage returns the notifications a message created.
+func (m *NotificationModel) GetForMessage(messageId int) ([]Notification, error) {
+	stmt := `SELECT ` + notificationColumns + `
+	         FROM notifications
+	         INNER JOIN users ON users.id = notifications.actor_id
+	         INNER JOIN messages ON messages.id = notifications.message_id
+	         WHERE notifications.message_id = $1`
+
+	return m.query(stmt, messageId)
+}
+
+func (m *NotificationModel) CountUnread(userId int) (int, error) {
+	stmt := "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL"
+
+	var count int
+	err := m.DB.QueryRow(stmt, userId).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks the given notifications as read, or all of them when ids
+// is empty.
+func (m *NotificationModel) MarkRead(userId int, ids []int) error {
+	stmt := "UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL"
+	args := []any{userId}
+
+	if len(ids) > 0 {
+		stmt += " AND id = ANY($2)"
+		args = append(args, pq.Array(ids))
+	}
+
+	_, err := m.DB.Exec(stmt, args...)
+	return err
+}
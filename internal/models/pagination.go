@@ -0,0 +1,125 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a list ordered by id, newest first. Before pages
+// towards older items and After towards newer ones; only one is set. It is
+// handed to clients as an opaque string.
+type Cursor struct {
+	Before int `json:"b,omitempty"`
+	After  int `json:"a,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err = json.Unmarshal(js, &c); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	if (c.Before > 0) == (c.After > 0) {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// Page describes where a page of results sits in the full list. Next points
+// at older items and Prev at newer ones, each is null when there aren't any.
+// HasMore reports whether there is a next page.
+type Page struct {
+	Next    *string `json:"next"`
+	Prev    *string `json:"prev"`
+	HasMore bool    `json:"has_more"`
+}
+
+// keyset returns the condition selecting the rows after cursor on column,
+// using $argIndex, and the ORDER BY for them. The limit should be one more
+// than the page size so paginate can tell whether there are more rows.
+func keyset(cursor *Cursor, column string, argIndex int) (condition string, arg any, order string) {
+	switch {
+	case cursor == nil:
+		return "", nil, column + " DESC"
+	case cursor.After > 0:
+		return fmt.Sprintf("%s > $%d", column, argIndex), cursor.After, column + " ASC"
+	default:
+		return fmt.Sprintf("%s < $%d", column, argIndex), cursor.Before, column + " DESC"
+	}
+}
+
+// paginate trims rows fetched with keyset back to limit, puts them newest
+// first and builds the cursors around them.
+func paginate[T any](rows []T, limit int, cursor *Cursor, id func(T) int) ([]T, Page) {
+	extra := len(rows) > limit
+	if extra {
+		rows = rows[:limit]
+	}
+
+	hasOlder, hasNewer := extra, false
+	if cursor != nil && cursor.After > 0 {
+		slices.Reverse(rows)
+		hasOlder, hasNewer = true, extra
+	} else if cursor != nil {
+		hasNewer = true
+	}
+
+	return rows, newPage(rows, id, hasOlder, hasNewer)
+}
+
+// paginateFrom is paginate for lists that can also be paged with an offset
+// instead of a cursor. Any page past the first has newer rows before it.
+func paginateFrom[T any](rows []T, limit int, cursor *Cursor, offset int, id func(T) int) ([]T, Page) {
+	rows, page := paginate(rows, limit, cursor, id)
+
+	if cursor == nil && offset > 0 && len(rows) > 0 {
+		prev := Cursor{After: id(rows[0])}.Encode()
+		page.Prev = &prev
+	}
+
+	return rows, page
+}
+
+// newPage builds the cursors for rows ordered newest first.
+func newPage[T any](rows []T, id func(T) int, hasOlder, hasNewer bool) Page {
+	page := Page{HasMore: hasOlder}
+	if len(rows) == 0 {
+		return page
+	}
+
+	if hasOlder {
+		next := Cursor{Before: id(rows[len(rows)-1])}.Encode()
+		page.Next = &next
+	}
+
+	if hasNewer {
+		prev := Cursor{After: id(rows[0])}.Encode()
+		page.Prev = &prev
+	}
+
+	return page
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func identity(i int) int { return i }
+
+func decodePageCursor(t *testing.T, s *string) *Cursor {
+	t.Helper()
+
+	if s == nil {
+		return nil
+	}
+
+	c, err := DecodeCursor(*s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &c
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows       []int
+		cursor     *Cursor
+		offset     int
+		want       []int
+		next, prev *Cursor
+	}{
+		{"first page", []int{9, 8, 7, 6}, nil, 0, []int{9, 8, 7}, &Cursor{Before: 7}, nil},
+		{"last page", []int{3, 2}, nil, 0, []int{3, 2}, nil, nil},
+		{"offset page", []int{6, 5, 4, 3}, nil, 3, []int{6, 5, 4}, &Cursor{Before: 4}, &Cursor{After: 6}},
+		{"last offset page", []int{3, 2}, nil, 6, []int{3, 2}, nil, &Cursor{After: 3}},
+		{"empty offset page", []int{}, nil, 30, []int{}, nil, nil},
+		{"before", []int{6, 5, 4, 3}, &Cursor{Before: 7}, 0, []int{6, 5, 4}, &Cursor{Before: 4}, &Cursor{After: 6}},
+		{"after", []int{8, 9, 10, 11}, &Cursor{After: 7}, 0, []int{10, 9, 8}, &Cursor{Before: 8}, &Cursor{After: 10}},
+		{"after the newest", []int{8, 9}, &Cursor{After: 7}, 0, []int{9, 8}, &Cursor{Before: 8}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, page := paginateFrom(slices.Clone(tt.rows), 3, tt.cursor, tt.offset, identity)
+
+			if !slices.Equal(rows, tt.want) {
+				t.Errorf("got rows %v, want %v", rows, tt.want)
+			}
+
+			for _, c := range []struct {
+				name      string
+				got, want *Cursor
+			}{{"next", decodePageCursor(t, page.Next), tt.next}, {"prev", decodePageCursor(t, page.Prev), tt.prev}} {
+				if (c.got == nil) != (c.want == nil) || c.got != nil && *c.got != *c.want {
+					t.Errorf("got %s %v, want %v", c.name, c.got, c.want)
+				}
+			}
+
+			if page.HasMore != (tt.next != nil) {
+				t.Errorf("got has_more %v", page.HasMore)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPollClosed  = errors.New("poll is closed")
+	ErrInvalidVote = errors.New("invalid poll options")
+)
+
+type PollOption struct {
+	ID    int    `json:"id"`
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+type Poll struct {
+	ID             int          `json:"id"`
+	ThreadId       int          `json:"thread_id"`
+	MessageId      *int         `json:"message_id"`
+	Question       string       `json:"question"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	ClosesAt       *time.Time   `json:"closes_at"`
+	Closed         bool         `json:"closed"`
+	Options        []PollOption `json:"options"`
+	// Number of users who voted, with multiple choice polls this is less
+	// than the sum of the option votes
+	Voters int `json:"voters"`
+}
+
+type PollModel struct {
+	DB *sql.DB
+}
+
+// Create stores poll with one option per entry in options, in order.
+func (m *PollModel) Create(poll Poll, options []string) (Poll, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Poll{}, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO polls (thread_id, message_id, question, multiple_choice, closes_at)
+	         VALUES($1, $2, $3, $4, $5) RETURNING id`
+
+	var id int
+	err = tx.QueryRow(stmt, poll.ThreadId, poll.MessageId, poll.Question, poll.MultipleChoice, poll.ClosesAt).Scan(&id)
+	if err != nil {
+		return Poll{}, err
+	}
+
+	stmt = "INSERT INTO poll_options (poll_id, position, text) VALUES($1, $2, $3)"
+	for i, text := range options {
+		if _, err = tx.Exec(stmt, id, i, text); err != nil {
+			return Poll{}, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Poll{}, err
+	}
+
+	return m.GetById(id)
+}
+
+func (m *PollModel) GetById(pollId int) (Poll, error) {
+	polls, err := loadPolls(m.DB, "id = ANY($1)", []int{pollId})
+	if err != nil {
+		return Poll{}, err
+	}
+
+	if len(polls) == 0 {
+		return Poll{}, ErrNoRecord
+	}
+
+	return *polls[0], nil
+}
+
+// Vote replaces the user's choices in the poll with optionIds.
+func (m *PollModel) Vote(pollId int, userId int, optionIds []int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var multipleChoice bool
+	var closesAt *time.Time
+	stmt := "SELECT multiple_choice, closes_at FROM polls WHERE id = $1 FOR SHARE"
+	err = tx.QueryRow(stmt, pollId).Scan(&multipleChoice, &closesAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if closesAt != nil && !closesAt.After(time.Now()) {
+		return ErrPollClosed
+	}
+
+	if len(optionIds) == 0 || (!multipleChoice && len(optionIds) > 1) {
+		return ErrInvalidVote
+	}
+
+	// Every option has to be distinct and belong to this poll
+	var valid int
+	stmt = "SELECT COUNT(*) FROM poll_options WHERE poll_id = $1 AND id = ANY($2)"
+	if err = tx.QueryRow(stmt, pollId, pq.Array(optionIds)).Scan(&valid); err != nil {
+		return err
+	}
+
+	if valid != len(optionIds) {
+		return ErrInvalidVote
+	}
+
+	// The poll is only shared, so concurrent votes of the same user are
+	// serialised here or both could replace the old choice
+	lockKey := advisoryLockKey(fmt.Sprintf("poll-vote:%d:%d", pollId, userId))
+	if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", lockKey); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM poll_votes WHERE poll_id = $1 AND user_id = $2", pollId, userId); err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO poll_votes (poll_id, option_id, user_id, multiple_choice)
+	         SELECT $1, option_id, $3, $4 FROM unnest($2::int[]) AS option_id`
+	if _, err = tx.Exec(stmt, pollId, pq.Array(optionIds), userId, multipleChoice); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveVote takes back all of the user's choices in the poll.
+func (m *PollModel) RemoveVote(pollId int, userId int) error {
+	stmt := `DELETE FROM poll_votes
+	         WHERE poll_id = $1 AND user_id = $2
+	           AND NOT EXISTS (SELECT true FROM polls WHERE id = $1 AND closes_at <= now())`
+
+	result, err := m.DB.Exec(stmt, pollId, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// loadPolls returns the polls matching where, which is given ids as $1,
+// with their options and tallies.
+func loadPolls(db *sql.DB, where string, ids []int) ([]*Poll, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	stmt := `SELECT id, thread_id, message_id, question, multiple_choice, closes_at,
+	                (SELECT COUNT(DISTINCT user_id) FROM poll_votes WHERE poll_votes.poll_id = polls.id)
+	         FROM polls WHERE ` + where
+
+	rows, err := db.Query(stmt, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var polls []*Poll
+	byId := make(map[int]*Poll)
+	for rows.Next() {
+		poll := &Poll{Options: []PollOption{}}
+		err = rows.Scan(&poll.ID, &poll.ThreadId, &poll.MessageId, &poll.Question, &poll.MultipleChoice, &poll.ClosesAt, &poll.Voters)
+		if err != nil {
+			return nil, err
+		}
+		poll.Closed = poll.ClosesAt != nil && !poll.ClosesAt.After(now)
+
+		polls = append(polls, poll)
+		byId[poll.ID] = poll
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(polls) == 0 {
+		return nil, nil
+	}
+
+	pollIds := make([]int, 0, len(polls))
+	for _, poll := range polls {
+		pollIds = append(pollIds, poll.ID)
+	}
+
+	stmt = `SELECT poll_options.id, poll_options.poll_id, poll_options.text, COUNT(poll_votes.user_id)
+	        FROM poll_options
+	        LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+	        WHERE poll_options.poll_id = ANY($1)
+	        GROUP BY poll_options.id
+	        ORDER BY poll_options.poll_id, poll_options.position`
+
+	optionRows, err := db.Query(stmt, pq.Array(pollIds))
+	if err != nil {
+		return nil, err
+	}
+	defer optionRows.Close()
+
+	for optionRows.Next() {
+		var option PollOption
+		var pollId int
+		if err = optionRows.Scan(&option.ID, &pollId, &option.Text, &option.Votes); err != nil {
+			return nil, err
+		}
+		byId[pollId].Options = append(byId[pollId].Options, option)
+	}
+
+	return polls, optionRows.Err()
+}
+
+// attachThreadPolls fills in the Poll of every thread that has one.
+func attachThreadPolls(db *sql.DB, threads []*Thread) error {
+	ids := make([]int, 0, len(threads))
+	for _, thread := range threads {
+		ids = append(ids, thread.ID)
+	}
+
+	polls, err := loadPolls(db, "thread_id = ANY($1) AND message_id IS NULL", ids)
+	if err != nil {
+		return err
+	}
+
+	byThread := make(map[int]*Poll, len(polls))
+	for _, poll := range polls {
+		byThread[poll.ThreadId] = poll
+	}
+
+	for _, thread := range threads {
+		thread.Poll = byThread[thread.ID]
+	}
+
+	return nil
+}
+
+// attachMessagePolls fills in the Poll of every message that has one.
+func attachMessagePolls(db *sql.DB, messages []Message) error {
+	ids := make([]int, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	polls, err := loadPolls(db, "message_id = ANY($1)", ids)
+	if err != nil {
+		return err
+	}
+
+	byMessage := make(map[int]*Poll, len(polls))
+	for _, poll := range polls {
+		byMessage[*poll.MessageId] = poll
+	}
+
+	for i := range messages {
+		messages[i].Poll = byMessage[messages[i].ID]
+	}
+
+	return nil
+}
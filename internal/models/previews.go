@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	SiteName    string `json:"site_name"`
+}
+
+type LinkPreviewModel struct {
+	DB *sql.DB
+}
+
+// SetLinks replaces the links recorded for a message.
+func (m *LinkPreviewModel) SetLinks(messageId int, urls []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM message_links WHERE message_id = $1", messageId); err != nil {
+		return err
+	}
+
+	stmt := "INSERT INTO message_links (message_id, position, url) VALUES($1, $2, $3)"
+	for i, url := range urls {
+		if _, err = tx.Exec(stmt, messageId, i, url); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetCached returns the stored preview of url when it was fetched after
+// since. failed is set when the last fetch didn't produce a preview.
+func (m *LinkPreviewModel) GetCached(url string, since time.Time) (preview LinkPreview, failed bool, err error) {
+	stmt := `SELECT url, title, description, image, site_name, failed
+	         FROM link_previews
+	         WHERE url = $1 AND fetched_at > $2`
+
+	err = m.DB.QueryRow(stmt, url, since).Scan(&preview.URL, &preview.Title, &preview.Description, &preview.Image, &preview.SiteName, &failed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LinkPreview{}, false, ErrNoRecord
+		}
+		return LinkPreview{}, false, err
+	}
+
+	return preview, failed, nil
+}
+
+// Save caches the preview of url, or that fetching it failed.
+func (m *LinkPreviewModel) Save(url string, preview LinkPreview, failed bool) error {
+	stmt := `INSERT INTO link_previews (url, title, description, image, site_name, failed, fetched_at)
+	         VALUES($1, $2, $3, $4, $5, $6, NOW())
+	         ON CONFLICT (url) DO UPDATE SET
+	             title = EXCLUDED.title,
+	             description = EXCLUDED.description,
+	             image = EXCLUDED.image,
+	             site_name = EXCLUDED.site_name,
+	             failed = EXCLUDED.failed,
+	             fetched_at = EXCLUDED.fetched_at`
+
+	_, err := m.DB.Exec(stmt, url, preview.Title, preview.Description, preview.Image, preview.SiteName, failed)
+	return err
+}
+
+func (m *LinkPreviewModel) GetForMessage(messageId int) ([]LinkPreview, error) {
+	messages := []Message{{ID: messageId}}
+	if err := attachPreviews(m.DB, messages); err != nil {
+		return nil, err
+	}
+
+	return messages[0].Previews, nil
+}
+
+// attachPreviews loads the previews of all messages in one query. Links
+// that haven't been fetched yet or failed are left out.
+func attachPreviews(db *sql.DB, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(messages))
+	index := make(map[int]int, len(messages))
+	for i := range messages {
+		messages[i].Previews = []LinkPreview{}
+		ids = append(ids, messages[i].ID)
+		index[messages[i].ID] = i
+	}
+
+	stmt := `SELECT message_links.message_id, link_previews.url, link_previews.title,
+	                link_previews.description, link_previews.image, link_previews.site_name
+	         FROM message_links
+	         INNER JOIN link_previews ON link_previews.url = message_links.url
+	         WHERE message_links.message_id = ANY($1) AND NOT link_previews.failed
+	         ORDER BY message_links.message_id, message_links.position`
+
+	rows, err := db.Query(stmt, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId int
+		var p LinkPreview
+		if err = rows.Scan(&messageId, &p.URL, &p.Title, &p.Description, &p.Image, &p.SiteName); err != nil {
+			return err
+		}
+		i := index[messageId]
+		messages[i].Previews = append(messages[i].Previews, p)
+	}
+
+	return rows.Err()
+}
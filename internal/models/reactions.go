@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Reaction is the aggregate of one emoji on a message. Me is set when the
+// user the messages were loaded for reacted with it.
+type Reaction struct {
+	Count int  `json:"count"`
+	Me    bool `json:"me"`
+}
+
+type ReactionModel struct {
+	DB *sql.DB
+}
+
+// Add reacts to a message with emoji. Reacting twice is a no-op and
+// reports added as false.
+func (m *ReactionModel) Add(messageId int, userId int, emoji string) (bool, error) {
+	stmt := `INSERT INTO message_reactions (message_id, user_id, emoji) VALUES($1, $2, $3)
+	         ON CONFLICT (message_id, emoji, user_id) DO NOTHING`
+
+	result, err := m.DB.Exec(stmt, messageId, userId, emoji)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (m *ReactionModel) Remove(messageId int, userId int, emoji string) error {
+	stmt := "DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3"
+
+	result, err := m.DB.Exec(stmt, messageId, userId, emoji)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Count returns how many users reacted to the message with emoji.
+func (m *ReactionModel) Count(messageId int, emoji string) (int, error) {
+	stmt := "SELECT COUNT(*) FROM message_reactions WHERE message_id = $1 AND emoji = $2"
+
+	var count int
+	err := m.DB.QueryRow(stmt, messageId, emoji).Scan(&count)
+	return count, err
+}
+
+// attachReactions loads the reactions of all messages in one query. viewerId
+// marks the viewer's own reactions, 0 marks none.
+func attachReactions(db *sql.DB, messages []Message, viewerId int) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(messages))
+	index := make(map[int]int, len(messages))
+	for i := range messages {
+		messages[i].Reactions = map[string]Reaction{}
+		ids = append(ids, messages[i].ID)
+		index[messages[i].ID] = i
+	}
+
+	stmt := `SELECT message_id, emoji, COUNT(*), COALESCE(BOOL_OR(user_id = $2), FALSE)
+	         FROM message_reactions
+	         WHERE message_id = ANY($1)
+	         GROUP BY message_id, emoji`
+
+	rows, err := db.Query(stmt, pq.Array(ids), viewerId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId int
+		var emoji string
+		var reaction Reaction
+		if err = rows.Scan(&messageId, &emoji, &reaction.Count, &reaction.Me); err != nil {
+			return err
+		}
+		messages[index[messageId]].Reactions[emoji] = reaction
+	}
+
+	return rows.Err()
+}
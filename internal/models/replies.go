@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// MaxSnapshotLen is how many characters of the parent's text a reply embeds.
+const MaxSnapshotLen = 100
+
+// ReplySnapshot is the short view of the message a reply answers. When the
+// parent has been deleted only ID and Deleted are set.
+type ReplySnapshot struct {
+	ID       int    `json:"id"`
+	UserId   int    `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Text     string `json:"text,omitempty"`
+	HasImage bool   `json:"has_image,omitempty"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// attachReplies loads the parents of every reply in one query.
+func attachReplies(db *sql.DB, messages []Message) error {
+	var ids []int
+	for _, message := range messages {
+		if message.ReplyToId != nil {
+			ids = append(ids, *message.ReplyToId)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	stmt := `SELECT messages.id, messages.user_id, users.username, messages.text, messages.image <> ''
+	         FROM messages
+	         INNER JOIN users ON users.id = messages.user_id
+	         WHERE messages.id = ANY($1) AND messages.deleted_at IS NULL
+	           AND NOT messages.held_for_review AND NOT messages.shadow_hidden`
+
+	rows, err := db.Query(stmt, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	parents := make(map[int]*ReplySnapshot, len(ids))
+	for rows.Next() {
+		parent := &ReplySnapshot{}
+		if err = rows.Scan(&parent.ID, &parent.UserId, &parent.Username, &parent.Text, &parent.HasImage); err != nil {
+			return err
+		}
+		parent.Text = truncate(parent.Text, MaxSnapshotLen)
+		parents[parent.ID] = parent
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range messages {
+		parentId := messages[i].ReplyToId
+		if parentId == nil {
+			continue
+		}
+
+		if parent, ok := parents[*parentId]; ok {
+			messages[i].ReplyTo = parent
+		} else {
+			messages[i].ReplyTo = &ReplySnapshot{ID: *parentId, Deleted: true}
+		}
+	}
+
+	return nil
+}
+
+// truncate cuts text to at most n characters, marking the cut with an
+// ellipsis.
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	return string(runes[:n-1]) + "…"
+}
@@ -3,7 +3,6 @@ package models
 import (
 	"database/sql"
 	"fmt"
-	"strings"
 )
 
 type Report struct {
@@ -18,12 +17,15 @@ type ReportQuery struct {
 	Search    string
 	PageSize  int
 	PageIndex int
+	// Takes the place of PageIndex when set
+	Cursor *Cursor
 }
 
 type ReportQueryResult struct {
 	Total   int      `json:"total"`
 	Count   int      `json:"count"`
 	Reports []Report `json:"reports"`
+	Page
 }
 
 type ReportModel struct {
@@ -112,31 +114,28 @@ func (m *ReportModel) Query(query ReportQuery) (ReportQueryResult, error) {
 		argIndex++
 	}
 
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = " WHERE " + strings.Join(conditions, " AND ")
-	}
-
 	// Get total count
-	countQuery := "SELECT COUNT(*) " + baseQuery + whereClause
+	countQuery := "SELECT COUNT(*) " + baseQuery + whereClause(conditions)
 	err := m.DB.QueryRow(countQuery, args...).Scan(&result.Total)
 	if err != nil {
 		return ReportQueryResult{}, err
 	}
 
-	// Build the main query with pagination
-	selectQuery := "SELECT id, reason, reporter_id, message_id, created_at " + baseQuery + whereClause + " ORDER BY created_at DESC"
-
-	// Add pagination
-	if query.PageSize > 0 {
-		selectQuery += fmt.Sprintf(" LIMIT $%d", argIndex)
-		args = append(args, query.PageSize)
+	condition, arg, order := keyset(query.Cursor, "id", argIndex)
+	if condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
 		argIndex++
+	}
 
-		if query.PageIndex > 0 {
-			selectQuery += fmt.Sprintf(" OFFSET $%d", argIndex)
-			args = append(args, query.PageIndex*query.PageSize)
-		}
+	// Build the main query with pagination, one extra row tells if there are more
+	selectQuery := "SELECT id, reason, reporter_id, message_id, created_at " + baseQuery + whereClause(conditions) + " ORDER BY " + order
+	selectQuery += fmt.Sprintf(" LIMIT $%d", argIndex)
+	args = append(args, query.PageSize+1)
+
+	if query.Cursor == nil && query.PageIndex > 0 {
+		selectQuery += fmt.Sprintf(" OFFSET $%d", argIndex+1)
+		args = append(args, query.PageIndex*query.PageSize)
 	}
 
 	// Execute the main query
@@ -146,7 +145,7 @@ func (m *ReportModel) Query(query ReportQuery) (ReportQueryResult, error) {
 	}
 	defer rows.Close()
 
-	var reports []Report
+	reports := []Report{}
 	for rows.Next() {
 		var report Report
 		err := rows.Scan(&report.ID, &report.Reason, &report.ReporterId, &report.MessageId, &report.CreatedAt)
@@ -160,8 +159,8 @@ func (m *ReportModel) Query(query ReportQuery) (ReportQueryResult, error) {
 		return ReportQueryResult{}, err
 	}
 
-	result.Reports = reports
-	result.Count = len(reports)
+	result.Reports, result.Page = paginateFrom(reports, query.PageSize, query.Cursor, query.PageIndex*query.PageSize, func(r Report) int { return r.ID })
+	result.Count = len(result.Reports)
 
 	return result, nil
 }
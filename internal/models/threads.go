@@ -1,58 +1,499 @@
 package models
 
 import (
-	"crypto/rand"
 	"database/sql"
 	"errors"
+	"fmt"
 	"math"
-	"math/big"
+	"math/rand/v2"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
+	"globechat.live/internal/geo"
 )
 
 type Thread struct {
+	ID             int        `json:"id"`
+	Lat            float64    `json:"lat"`
+	Long           float64    `json:"long"`
+	Message        string     `json:"message"`
+	Replies        int        `json:"replies"`
+	UserId         int        `json:"user_id"`
+	Username       string     `json:"username"`
+	UserImage      string     `json:"user_image"`
+	CreatedAt      time.Time  `json:"created_at"`
+	PlaceName      string     `json:"place_name"`
+	CountryCode    string     `json:"country_code"`
+	EditedAt       *time.Time `json:"edited_at"`
+	Locked         bool       `json:"locked"`
+	Pinned         bool       `json:"pinned"`
+	LastActivityAt time.Time  `json:"last_activity_at"`
+	HeldForReview  bool       `json:"held_for_review"`
+	// Seconds everyone but the owner and moderators must wait between
+	// messages, 0 when slow mode is off
+	SlowModeSeconds int   `json:"slow_mode_seconds"`
+	Poll            *Poll `json:"poll"`
+	// Set when the thread has been deleted, see Redact
+	Deleted *Tombstone `json:"deleted"`
+	// Caught by a content filter and only shown to its author, who
+	// mustn't find out
+	ShadowHidden bool `json:"-"`
+	// ExpiresAt field removed
+}
+
+// MapPoint is the minimal view of a thread used to draw map tiles.
+type MapPoint struct {
+	ID        int
+	Lat       float64
+	Long      float64
+	Replies   int
+	CreatedAt time.Time
+}
+
+type ThreadRevision struct {
 	ID        int       `json:"id"`
-	Lat       float64   `json:"lat"`
-	Long      float64   `json:"long"`
+	ThreadId  int       `json:"thread_id"`
 	Message   string    `json:"message"`
-	Replies   int       `json:"replies"`
-	UserId    int       `json:"user_id"`
-	Username  string    `json:"username"`
-	UserImage string    `json:"user_image"`
+	EditedBy  int       `json:"edited_by"`
 	CreatedAt time.Time `json:"created_at"`
-	// ExpiresAt field removed
 }
 
 type ThreadModel struct {
 	DB *sql.DB
 }
 
-func (m *ThreadModel) Create(message string, lat float64, long float64, userId int) (Thread, error) {
+// threadColumns is selected by every thread query, joined with users, in
+// the order scanThread reads them.
+const threadColumns = `threads.id, threads.lat, threads.long, threads.message, threads.user_id, threads.created_at,
+	users.username, users.image, threads.place_name, threads.country_code, threads.edited_at,
+	threads.locked, threads.pinned, threads.replies, threads.last_activity_at,
+	threads.held_for_review, threads.deleted_at, threads.deleted_by, threads.shadow_hidden, threads.slow_mode_seconds`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanThread reads threadColumns followed by any extra columns the query
+// selected after them.
+func scanThread(row rowScanner, extra ...any) (*Thread, error) {
+	thread := &Thread{}
+	var deletedAt sql.NullTime
+	var deletedBy sql.NullInt64
+	dest := []any{&thread.ID, &thread.Lat, &thread.Long, &thread.Message, &thread.UserId, &thread.CreatedAt,
+		&thread.Username, &thread.UserImage, &thread.PlaceName, &thread.CountryCode, &thread.EditedAt,
+		&thread.Locked, &thread.Pinned, &thread.Replies, &thread.LastActivityAt,
+		&thread.HeldForReview, &deletedAt, &deletedBy, &thread.ShadowHidden, &thread.SlowModeSeconds}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	thread.Deleted = newTombstone(deletedAt, deletedBy, thread.UserId)
+
+	return thread, nil
+}
+
+func (m *ThreadModel) queryThreads(stmt string, args ...any) ([]*Thread, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := make([]*Thread, 0)
+	for rows.Next() {
+		thread, err := scanThread(rows)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, thread)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = attachThreadPolls(m.DB, threads); err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+// ThreadLimits are the invariants checked before a thread is created.
+type ThreadLimits struct {
+	// No other thread may exist within this distance of a new one
+	MinSpacingKm float64
+	// How many threads a single user may have at once
+	MaxPerUser int
+	// Zone rules at the new thread's location, including per zone limits
+	Rules ZoneRules
+}
+
+const (
+	// Size in degrees of the grid cells locked while a new thread's spacing
+	// is checked
+	threadLockCellDegrees = 0.1
+	// Spacing boxes touching more cells than this, near the poles or the
+	// antimeridian, take one shared lock instead
+	threadLockMaxCells = 16
+)
+
+// threadLockKeys returns the transaction level advisory locks, sorted, held
+// while the limits are checked and the thread inserted, so concurrent
+// requests can't both pass the checks. The user's lock covers their thread
+// count. The spacing check locks the cell of the new thread and every cell
+// its spacing box touches: two threads closer than the spacing each lie in
+// the other's box, so they always share the cell of one of them.
+func threadLockKeys(lat, long float64, userId int, limits ThreadLimits) []int64 {
+	keys := []int64{advisoryLockKey(fmt.Sprintf("thread-user:%d", userId))}
+	if limits.MinSpacingKm <= 0 {
+		return keys
+	}
+
+	cell := func(row, col int) int64 {
+		return advisoryLockKey(fmt.Sprintf("thread-cell:%d:%d", row, col))
+	}
+	index := func(degrees float64) int {
+		return int(math.Floor(degrees / threadLockCellDegrees))
+	}
+
+	keys = append(keys, cell(index(lat), index(long)))
+
+	box := geo.CircleBounds(lat, long, limits.MinSpacingKm)
+	minRow, maxRow := index(box.MinLat), index(box.MaxLat)
+	minCol, maxCol := index(box.MinLong), index(box.MaxLong)
+
+	if (maxRow-minRow+1)*(maxCol-minCol+1) > threadLockMaxCells {
+		keys = append(keys, advisoryLockKey("thread-cell:wide"))
+	} else {
+		for row := minRow; row <= maxRow; row++ {
+			for col := minCol; col <= maxCol; col++ {
+				keys = append(keys, cell(row, col))
+			}
+		}
+	}
+
+	// Always locking in the same order keeps overlapping requests from
+	// deadlocking
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// Create inserts a thread after checking it against limits. Violations are
+// returned as a *ThreadLimitError. Threads are held for review when either
+// the zone rules or visibility ask for it.
+func (m *ThreadModel) Create(message string, lat float64, long float64, place geo.Place, userId int, limits ThreadLimits, visibility Visibility) (Thread, error) {
 	if len(message) > 280 {
 		return Thread{}, ErrTextTooLong
 	}
-	stmt := "INSERT INTO threads (message, lat, long, user_id) VALUES($1, $2, $3, $4) RETURNING id, lat, long, message, user_id, created_at"
 
-	var thread Thread
-	err := m.DB.QueryRow(stmt, message, lat, long, userId).Scan(&thread.ID, &thread.Lat, &thread.Long, &thread.Message, &thread.UserId, &thread.CreatedAt)
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Thread{}, err
+	}
+	defer tx.Rollback()
+
+	for _, key := range threadLockKeys(lat, long, userId, limits) {
+		if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", key); err != nil {
+			return Thread{}, err
+		}
+	}
+
+	if err = checkThreadLimits(tx, lat, long, userId, limits); err != nil {
+		return Thread{}, err
+	}
+
+	stmt := "INSERT INTO threads (message, lat, long, place_name, country_code, user_id, held_for_review, shadow_hidden) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+
+	held := limits.Rules.RequireReview || visibility == VisibilityHeld
+	var id int
+	err = tx.QueryRow(stmt, message, lat, long, place.Name, place.CountryCode, userId, held, visibility == VisibilityShadow).Scan(&id)
 
 	if err != nil {
 		return Thread{}, err
 	}
 
-	var user User
+	if err = tx.Commit(); err != nil {
+		return Thread{}, err
+	}
+
+	return m.GetById(id)
+}
+
+func checkThreadLimits(tx *sql.Tx, lat, long float64, userId int, limits ThreadLimits) error {
+	if limits.MinSpacingKm > 0 {
+		// The box narrows the search down to an index range before the
+		// exact distance is computed
+		box := geo.CircleBounds(lat, long, limits.MinSpacingKm)
+
+		stmt := `SELECT EXISTS(
+				SELECT true FROM threads
+				WHERE deleted_at IS NULL
+				  AND lat BETWEEN $4 AND $5
+				  AND long BETWEEN $6 AND $7
+				  AND (
+					6371 * acos(LEAST(1,
+						cos(radians($1)) * cos(radians(lat)) *
+						cos(radians(long) - radians($2)) +
+						sin(radians($1)) * sin(radians(lat))
+					))
+				) <= $3
+			 )`
+
+		var tooClose bool
+		err := tx.QueryRow(stmt, lat, long, limits.MinSpacingKm, box.MinLat, box.MaxLat, box.MinLong, box.MaxLong).Scan(&tooClose)
+		if err != nil {
+			return err
+		}
 
-	stmt = "SELECT username, image FROM users WHERE id = $1"
-	err = m.DB.QueryRow(stmt, userId).Scan(&user.Username, &user.Image)
+		if tooClose {
+			return &ThreadLimitError{
+				Reason:       ThreadLimitSpacing,
+				Message:      "too close to other threads",
+				MinSpacingKm: limits.MinSpacingKm,
+			}
+		}
+	}
 
+	rows, err := tx.Query("SELECT lat, long FROM threads WHERE user_id = $1 AND deleted_at IS NULL", userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Only the location is needed to check zone limits
+	var userThreads []*Thread
+	for rows.Next() {
+		thread := &Thread{}
+		if err = rows.Scan(&thread.Lat, &thread.Long); err != nil {
+			return err
+		}
+		userThreads = append(userThreads, thread)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if limits.MaxPerUser > 0 && len(userThreads) >= limits.MaxPerUser {
+		return &ThreadLimitError{
+			Reason:  ThreadLimitUser,
+			Message: "too many threads",
+			Limit:   limits.MaxPerUser,
+		}
+	}
+
+	if zone, exceeded := limits.Rules.ExceededThreadLimit(userThreads); exceeded {
+		return &ThreadLimitError{
+			Reason:  ThreadLimitZone,
+			Message: fmt.Sprintf("too many threads in %s, the limit is %d", zone.Name, zone.ThreadLimit),
+			Limit:   zone.ThreadLimit,
+			Zone:    zone.Name,
+		}
+	}
+
+	return nil
+}
+
+// Update replaces the thread text and its first message together, keeping
+// the previous text as a revision.
+func (m *ThreadModel) Update(threadId int, message string, editorId int) (Thread, error) {
+	if len(message) > 280 {
+		return Thread{}, ErrTextTooLong
+	}
+
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return Thread{}, err
 	}
-	thread.Username = user.Username
-	thread.UserImage = user.Image
-	return thread, nil
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRow("SELECT message FROM threads WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", threadId).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Thread{}, ErrNoRecord
+		}
+		return Thread{}, err
+	}
+
+	stmt := "INSERT INTO thread_revisions (thread_id, message, edited_by) VALUES($1, $2, $3)"
+	if _, err = tx.Exec(stmt, threadId, previous, editorId); err != nil {
+		return Thread{}, err
+	}
+
+	stmt = "UPDATE threads SET message = $1, edited_at = NOW() WHERE id = $2"
+	if _, err = tx.Exec(stmt, message, threadId); err != nil {
+		return Thread{}, err
+	}
+
+	mentions, _, err := resolveMentions(tx, message)
+	if err != nil {
+		return Thread{}, err
+	}
+
+	mentionsData, err := mentionsJSON(mentions)
+	if err != nil {
+		return Thread{}, err
+	}
+
+	stmt = "UPDATE messages SET text = $1, mentions = $2, edited_at = NOW() WHERE thread_id = $3 AND is_first"
+	if _, err = tx.Exec(stmt, message, mentionsData, threadId); err != nil {
+		return Thread{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Thread{}, err
+	}
+
+	return m.GetById(threadId)
+}
+
+func (m *ThreadModel) SetLocked(threadId int, locked bool) error {
+	return m.setFlag("locked", threadId, locked)
+}
+
+func (m *ThreadModel) SetHeldForReview(threadId int, held bool) error {
+	return m.setFlag("held_for_review", threadId, held)
+}
+
+// GetHeldForReview returns threads waiting for a moderator, oldest first.
+func (m *ThreadModel) GetHeldForReview() ([]*Thread, error) {
+	stmt := `SELECT ` + threadColumns + `
+	         FROM threads
+	         INNER JOIN users ON users.id = threads.user_id
+	         WHERE held_for_review AND threads.deleted_at IS NULL
+	         ORDER BY threads.created_at ASC`
+
+	return m.queryThreads(stmt)
+}
+
+func (m *ThreadModel) SetPinned(threadId int, pinned bool) error {
+	return m.setFlag("pinned", threadId, pinned)
 }
 
-func (m *ThreadModel) Delete(threadId int) error {
+// SetSlowMode sets the cooldown between messages in a thread, 0 turns slow
+// mode off.
+func (m *ThreadModel) SetSlowMode(threadId int, seconds int) error {
+	stmt := "UPDATE threads SET slow_mode_seconds = $1 WHERE id = $2 AND deleted_at IS NULL"
+
+	result, err := m.DB.Exec(stmt, seconds, threadId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// setFlag updates one of the moderation booleans on a thread, deleted
+// threads can't be changed. column is never user input.
+func (m *ThreadModel) setFlag(column string, threadId int, value bool) error {
+	stmt := fmt.Sprintf("UPDATE threads SET %s = $1 WHERE id = $2 AND deleted_at IS NULL", column)
+
+	result, err := m.DB.Exec(stmt, value, threadId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// GetRevisions returns the previous versions of a thread, newest first.
+func (m *ThreadModel) GetRevisions(threadId int) ([]ThreadRevision, error) {
+	stmt := `SELECT id, thread_id, message, edited_by, created_at
+	         FROM thread_revisions
+	         WHERE thread_id = $1
+	         ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, threadId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []ThreadRevision{}
+	for rows.Next() {
+		var revision ThreadRevision
+		err = rows.Scan(&revision.ID, &revision.ThreadId, &revision.Message, &revision.EditedBy, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Delete soft deletes a thread along with its messages, hiding them from
+// every listing and leaving tombstones until PurgeDeleted removes them.
+// deletedBy is the author or the moderator removing it.
+func (m *ThreadModel) Delete(threadId int, deletedBy int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := "UPDATE threads SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL"
+
+	result, err := tx.Exec(stmt, threadId, deletedBy)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	// Messages are fetched on their own too, by id, through reactions and
+	// in notifications, so they go with the thread. NOW() is the same
+	// within the transaction so they share the thread's tombstone time.
+	stmt = "UPDATE messages SET deleted_at = NOW(), deleted_by = $2 WHERE thread_id = $1 AND deleted_at IS NULL"
+	if _, err = tx.Exec(stmt, threadId, deletedBy); err != nil {
+		return err
+	}
+
+	stmt = "DELETE FROM notifications WHERE message_id IN (SELECT id FROM messages WHERE thread_id = $1)"
+	if _, err = tx.Exec(stmt, threadId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Purge permanently removes a thread and its messages, used to undo a
+// failed create.
+func (m *ThreadModel) Purge(threadId int) error {
 	stmt := "DELETE FROM threads WHERE id = $1"
 
 	result, err := m.DB.Exec(stmt, threadId)
@@ -72,20 +513,40 @@ func (m *ThreadModel) Delete(threadId int) error {
 	return nil
 }
 
+// PurgeDeleted permanently removes the threads deleted before the cutoff,
+// with their messages, returning how many there were.
+func (m *ThreadModel) PurgeDeleted(before time.Time) (int64, error) {
+	result, err := m.DB.Exec("DELETE FROM threads WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 // GetExpiredIds method removed since expires_at column no longer exists
 
+// GetById returns a thread unless it has been deleted.
 func (m *ThreadModel) GetById(threadId int) (Thread, error) {
-	stmt := `SELECT threads.id, lat, long, message, user_id, threads.created_at,
-             users.username, users.image 
+	return m.getById(threadId, false)
+}
+
+// GetByIdIncludingDeleted also returns deleted threads, with their
+// original content and a tombstone.
+func (m *ThreadModel) GetByIdIncludingDeleted(threadId int) (Thread, error) {
+	return m.getById(threadId, true)
+}
+
+func (m *ThreadModel) getById(threadId int, includeDeleted bool) (Thread, error) {
+	stmt := `SELECT ` + threadColumns + `
              FROM threads 
              INNER JOIN users ON users.id = threads.user_id 
              WHERE threads.id = $1`
+	if !includeDeleted {
+		stmt += " AND threads.deleted_at IS NULL"
+	}
 
-	row := m.DB.QueryRow(stmt, threadId)
-
-	thread := Thread{}
-	err := row.Scan(&thread.ID, &thread.Lat, &thread.Long, &thread.Message,
-		&thread.UserId, &thread.CreatedAt, &thread.Username, &thread.UserImage)
+	thread, err := scanThread(m.DB.QueryRow(stmt, threadId))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -94,44 +555,125 @@ func (m *ThreadModel) GetById(threadId int) (Thread, error) {
 		return Thread{}, err
 	}
 
-	return thread, nil
+	if err = attachThreadPolls(m.DB, []*Thread{thread}); err != nil {
+		return Thread{}, err
+	}
+
+	return *thread, nil
 }
 
-func (m *ThreadModel) GetRandomThread() (Thread, error) {
-	// Get total count first
-	var count int
-	countStmt := "SELECT COUNT(*) FROM threads"
-	err := m.DB.QueryRow(countStmt).Scan(&count)
-	if err != nil {
-		return Thread{}, err
+const (
+	RandomBiasNone   = ""
+	RandomBiasRecent = "recent"
+	RandomBiasActive = "active"
+)
+
+type RandomQuery struct {
+	// Prefer threads created in the last week or active in the last day,
+	// falling back to any thread when none match
+	Bias string
+
+	// Only pick threads inside these boxes, ignored when empty
+	Boxes []geo.BoundingBox
+
+	// Threads the caller has already seen
+	ExcludeIds []int
+
+	// Also skip threads this user has posted in, ignored when 0
+	ExcludeUserId int
+}
+
+// GetRandomThread samples a thread without counting or scanning the table.
+// Every thread has a random_key in [0, 1); the first key at or after a
+// random point is picked, wrapping around to the smallest key. Threads after
+// wide gaps between keys are favoured until ShuffleRandomKeys evens them out.
+func (m *ThreadModel) GetRandomThread(query RandomQuery) (Thread, error) {
+	if query.Bias != RandomBiasNone {
+		thread, err := m.sampleThread(query)
+		if !errors.Is(err, ErrNoRecord) {
+			return thread, err
+		}
+		query.Bias = RandomBiasNone
 	}
 
-	if count == 0 {
-		return Thread{}, sql.ErrNoRows
+	return m.sampleThread(query)
+}
+
+func (m *ThreadModel) sampleThread(query RandomQuery) (Thread, error) {
+	conditions := []string{"NOT held_for_review", "NOT shadow_hidden", "threads.deleted_at IS NULL"}
+	var args []interface{}
+
+	switch query.Bias {
+	case RandomBiasRecent:
+		conditions = append(conditions, "threads.created_at > NOW() - INTERVAL '7 days'")
+	case RandomBiasActive:
+		conditions = append(conditions, "threads.last_activity_at > NOW() - INTERVAL '24 hours'")
 	}
 
-	// Generate cryptographically secure random offset
-	maxBig := big.NewInt(int64(count))
-	randomOffset, err := rand.Int(rand.Reader, maxBig)
-	if err != nil {
-		return Thread{}, err
+	if len(query.Boxes) > 0 {
+		where, boxArgs := boundsCondition(query.Boxes, len(args)+1)
+		conditions = append(conditions, where)
+		args = append(args, boxArgs...)
 	}
 
-	stmt := `SELECT threads.id, lat, long, message, user_id, threads.created_at,
-			 users.username, users.image 
-			 FROM threads 
-			 INNER JOIN users ON users.id = threads.user_id 
-			 LIMIT 1 OFFSET $1`
+	if len(query.ExcludeIds) > 0 {
+		args = append(args, pq.Array(query.ExcludeIds))
+		conditions = append(conditions, fmt.Sprintf("threads.id <> ALL($%d)", len(args)))
+	}
 
-	row := m.DB.QueryRow(stmt, randomOffset.Int64())
+	if query.ExcludeUserId != 0 {
+		args = append(args, query.ExcludeUserId)
+		conditions = append(conditions, fmt.Sprintf(
+			"NOT EXISTS (SELECT 1 FROM messages WHERE messages.thread_id = threads.id AND messages.user_id = $%d)", len(args)))
+	}
 
-	thread := Thread{}
-	err = row.Scan(&thread.ID, &thread.Lat, &thread.Long, &thread.Message, &thread.UserId, &thread.CreatedAt, &thread.Username, &thread.UserImage)
+	args = append(args, rand.Float64())
+	pivot := len(args)
 
-	if err != nil {
-		return Thread{}, err
+	where := strings.Join(conditions, " AND ")
+
+	// Try at or after the pivot first, then wrap around to the start
+	for _, keyCondition := range []string{"random_key >= $%d", "random_key < $%d"} {
+		stmt := `SELECT ` + threadColumns + `
+		         FROM threads
+		         INNER JOIN users ON users.id = threads.user_id
+		         WHERE ` + where + ` AND ` + fmt.Sprintf(keyCondition, pivot) + `
+		         ORDER BY random_key
+		         LIMIT 1`
+
+		thread, err := scanThread(m.DB.QueryRow(stmt, args...))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return Thread{}, err
+		}
+
+		return *thread, nil
 	}
-	return thread, nil
+
+	return Thread{}, ErrNoRecord
+}
+
+// randomKeyShuffleBatch is how many threads ShuffleRandomKeys gives new keys
+// per run.
+const randomKeyShuffleBatch = 1000
+
+// ShuffleRandomKeys gives a run of threads starting at a random key new
+// keys, so over time no thread keeps the wide gap in front of it that makes
+// GetRandomThread pick it more often. It runs in the background rather than
+// on every sample to keep reads from writing.
+func (m *ThreadModel) ShuffleRandomKeys() error {
+	stmt := `UPDATE threads SET random_key = random()
+	         WHERE id IN (
+	             SELECT id FROM threads
+	             WHERE random_key >= $1 AND NOT held_for_review
+	             ORDER BY random_key
+	             LIMIT $2
+	         )`
+
+	_, err := m.DB.Exec(stmt, rand.Float64(), randomKeyShuffleBatch)
+	return err
 }
 
 func (m *ThreadModel) IncreaseReplies(threadId int) error {
@@ -200,75 +742,58 @@ func (m *ThreadModel) SetReplies(threadId int, replies int) error {
 	return nil
 }
 
-func (m *ThreadModel) GetAllByUserId(userId int) ([]*Thread, error) {
-	stmt := `SELECT threads.id, lat, long, message, user_id, threads.created_at,
-			 users.username, users.image 
-			 FROM threads 
-			 INNER JOIN users ON users.id = threads.user_id 
-			 WHERE user_id = $1 
-			 ORDER BY created_at DESC`
-
-	rows, err := m.DB.Query(stmt, userId)
+// ReconcileReplies recomputes reply counts and last activity for threads
+// whose stored values have drifted from their messages, returning how many
+// threads were fixed.
+func (m *ThreadModel) ReconcileReplies() (int64, error) {
+	stmt := `WITH actual AS (
+	             SELECT threads.id,
+	                    COUNT(messages.id) FILTER (WHERE NOT messages.is_first) AS replies,
+	                    COALESCE(MAX(messages.created_at), threads.created_at) AS last_activity_at
+	             FROM threads
+	             LEFT JOIN messages ON messages.thread_id = threads.id AND messages.deleted_at IS NULL
+	                                AND NOT messages.held_for_review AND NOT messages.shadow_hidden
+	             GROUP BY threads.id
+	         )
+	         UPDATE threads
+	         SET replies = actual.replies, last_activity_at = actual.last_activity_at
+	         FROM actual
+	         WHERE actual.id = threads.id
+	           AND (threads.replies <> actual.replies OR threads.last_activity_at IS DISTINCT FROM actual.last_activity_at)`
+
+	result, err := m.DB.Exec(stmt)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
 
-	threads := []*Thread{}
-
-	for rows.Next() {
-		thread := &Thread{}
-		err = rows.Scan(&thread.ID, &thread.Lat, &thread.Long, &thread.Message, &thread.UserId, &thread.CreatedAt, &thread.Username, &thread.UserImage)
-		if err != nil {
-			return nil, err
-		}
-		threads = append(threads, thread)
-	}
+	return result.RowsAffected()
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
+func (m *ThreadModel) GetAllByUserId(userId int) ([]*Thread, error) {
+	stmt := `SELECT ` + threadColumns + ` 
+			 FROM threads 
+			 INNER JOIN users ON users.id = threads.user_id 
+			 WHERE user_id = $1 AND threads.deleted_at IS NULL
+			 ORDER BY created_at DESC`
 
-	return threads, nil
+	return m.queryThreads(stmt, userId)
 }
 
 func (m *ThreadModel) GetByLocation(minLat, maxLat, minLong, maxLong float64) ([]*Thread, error) {
-	stmt := `SELECT threads.id, lat, long, message, user_id, threads.created_at,
-			 users.username, users.image
+	stmt := `SELECT ` + threadColumns + `
 			 FROM threads INNER JOIN users ON users.id = threads.user_id
 			 WHERE lat BETWEEN $1 AND $2 
 			 AND long BETWEEN $3 AND $4 
+			 AND threads.deleted_at IS NULL
 			 ORDER BY created_at DESC`
 
-	rows, err := m.DB.Query(stmt, minLat, maxLat, minLong, maxLong)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	threads := []*Thread{}
-
-	for rows.Next() {
-		thread := &Thread{}
-		err = rows.Scan(&thread.ID, &thread.Lat, &thread.Long, &thread.Message, &thread.UserId, &thread.CreatedAt, &thread.Username, &thread.UserImage)
-		if err != nil {
-			return nil, err
-		}
-		threads = append(threads, thread)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return threads, nil
+	return m.queryThreads(stmt, minLat, maxLat, minLong, maxLong)
 }
 
 func (m *ThreadModel) GetByLocationRadius(centerLat, centerLong, radiusKm float64) ([]*Thread, error) {
 	// Using the spherical law of cosines for distance calculation
 	// This is an approximation suitable for most use cases
-	stmt := `SELECT threads.id, lat, long, message, user_id, threads.created_at,
-			 users.username, users.image
+	stmt := `SELECT ` + threadColumns + `
 			 FROM threads INNER JOIN users ON users.id = threads.user_id
 			 WHERE (
 				6371 * acos(
@@ -277,30 +802,10 @@ func (m *ThreadModel) GetByLocationRadius(centerLat, centerLong, radiusKm float6
 					sin(radians($1)) * sin(radians(lat))
 				)
 			 ) <= $3
+			 AND threads.deleted_at IS NULL
 			 ORDER BY created_at DESC`
 
-	rows, err := m.DB.Query(stmt, centerLat, centerLong, radiusKm)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	threads := make([]*Thread, 0)
-
-	for rows.Next() {
-		thread := &Thread{}
-		err = rows.Scan(&thread.ID, &thread.Lat, &thread.Long, &thread.Message, &thread.UserId, &thread.CreatedAt, &thread.Username, &thread.UserImage)
-		if err != nil {
-			return nil, err
-		}
-		threads = append(threads, thread)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return threads, nil
+	return m.queryThreads(stmt, centerLat, centerLong, radiusKm)
 }
 
 func (m *ThreadModel) GetByLocationBounds(centerLat, centerLong, radiusKm float64) ([]*Thread, error) {
@@ -316,91 +821,218 @@ func (m *ThreadModel) GetByLocationBounds(centerLat, centerLong, radiusKm float6
 	minLng := centerLong - lngDelta
 	maxLng := centerLong + lngDelta
 
-	stmt := `SELECT threads.id, lat, long, message, user_id, threads.created_at,
-			 users.username, users.image
+	stmt := `SELECT ` + threadColumns + `
 			 FROM threads INNER JOIN users ON users.id = threads.user_id
 			 WHERE lat BETWEEN $1 AND $2 
 			   AND long BETWEEN $3 AND $4
+			   AND threads.deleted_at IS NULL
 			 ORDER BY created_at DESC`
 
-	rows, err := m.DB.Query(stmt, minLat, maxLat, minLng, maxLng)
-	if err != nil {
-		return nil, err
+	return m.queryThreads(stmt, minLat, maxLat, minLng, maxLng)
+}
+
+// boundsCondition builds a WHERE fragment matching any of the boxes, with
+// placeholders numbered from argIndex.
+func boundsCondition(boxes []geo.BoundingBox, argIndex int) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	for _, box := range boxes {
+		conditions = append(conditions, fmt.Sprintf("(lat BETWEEN $%d AND $%d AND long BETWEEN $%d AND $%d)",
+			argIndex, argIndex+1, argIndex+2, argIndex+3))
+		args = append(args, box.MinLat, box.MaxLat, box.MinLong, box.MaxLong)
+		argIndex += 4
 	}
-	defer rows.Close()
 
-	threads := make([]*Thread, 0)
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
 
-	for rows.Next() {
-		thread := &Thread{}
-		err = rows.Scan(&thread.ID, &thread.Lat, &thread.Long, &thread.Message, &thread.UserId, &thread.CreatedAt, &thread.Username, &thread.UserImage)
-		if err != nil {
-			return nil, err
-		}
-		threads = append(threads, thread)
+// GetByBounds returns the threads inside any of the boxes, optionally only
+// those labelled with countryCode. Callers should build the boxes with
+// geo.SplitBounds so antimeridian crossing viewports are handled.
+//
+// Pinned threads don't count towards threshold. When there are more than
+// threshold other threads, the pinned threads are still returned together
+// with ErrTooManyItems.
+func (m *ThreadModel) GetByBounds(boxes []geo.BoundingBox, countryCode string, threshold int) ([]*Thread, error) {
+	if len(boxes) == 0 {
+		return []*Thread{}, nil
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	where, args := boundsCondition(boxes, 1)
+
+	if countryCode != "" {
+		args = append(args, countryCode)
+		where += fmt.Sprintf(" AND country_code = $%d", len(args))
 	}
 
-	return threads, nil
-}
-func (m *ThreadModel) GetByBounds(minLat, minLng, maxLat, maxLng float64, threshold int) ([]*Thread, error) {
 	// First check count
-	countStmt := `SELECT COUNT(*) 
-	              FROM threads 
-	              WHERE lat BETWEEN $1 AND $2 
-	                AND long BETWEEN $3 AND $4`
+	// Threads waiting for review are only visible to their owner and admins
+	where += " AND NOT held_for_review AND NOT shadow_hidden AND deleted_at IS NULL"
+
+	countStmt := "SELECT COUNT(*) FROM threads WHERE NOT pinned AND " + where
 
 	var count int
-	err := m.DB.QueryRow(countStmt, minLat, maxLat, minLng, maxLng).Scan(&count)
+	err := m.DB.QueryRow(countStmt, args...).Scan(&count)
 	if err != nil {
 		return nil, err
 	}
 
-	// If too many, return nothing (or error)
+	// If too many, return only the pinned ones
 	if count > threshold {
-		return nil, ErrTooManyItems
+		stmt := `SELECT ` + threadColumns + `
+		         FROM threads
+		         INNER JOIN users ON users.id = threads.user_id
+		         WHERE pinned AND ` + where + `
+		         ORDER BY created_at DESC`
+
+		threads, err := m.queryThreads(stmt, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		return threads, ErrTooManyItems
 	}
 
 	// Otherwise fetch rows
-	stmt := `SELECT threads.id, lat, long, message, user_id, threads.created_at,
-	                users.username, users.image
+	stmt := `SELECT ` + threadColumns + `
 	         FROM threads
 	         INNER JOIN users ON users.id = threads.user_id
+	         WHERE ` + where + `
+	         ORDER BY pinned DESC, created_at DESC`
+
+	return m.queryThreads(stmt, args...)
+}
+
+// GetMapPoints returns up to limit visible threads inside the box, most
+// active first, with only the columns needed to draw them on a map.
+func (m *ThreadModel) GetMapPoints(box geo.BoundingBox, limit int) ([]MapPoint, error) {
+	stmt := `SELECT id, lat, long, replies, created_at
+	         FROM threads
 	         WHERE lat BETWEEN $1 AND $2
 	           AND long BETWEEN $3 AND $4
-	         ORDER BY created_at DESC`
+	           AND NOT held_for_review
+	           AND NOT shadow_hidden
+	           AND deleted_at IS NULL
+	         ORDER BY pinned DESC, last_activity_at DESC
+	         LIMIT $5`
 
-	rows, err := m.DB.Query(stmt, minLat, maxLat, minLng, maxLng)
+	rows, err := m.DB.Query(stmt, box.MinLat, box.MaxLat, box.MinLong, box.MaxLong, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	threads := make([]*Thread, 0)
+	points := []MapPoint{}
 	for rows.Next() {
-		thread := &Thread{}
-		err = rows.Scan(
-			&thread.ID,
-			&thread.Lat,
-			&thread.Long,
-			&thread.Message,
-			&thread.UserId,
-			&thread.CreatedAt,
-			&thread.Username,
-			&thread.UserImage,
-		)
+		var p MapPoint
+		err = rows.Scan(&p.ID, &p.Lat, &p.Long, &p.Replies, &p.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
-		threads = append(threads, thread)
+		points = append(points, p)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return threads, nil
+	return points, nil
+}
+
+type TrendingQuery struct {
+	// Bounding box filter, ignored when empty
+	Boxes []geo.BoundingBox
+
+	// Country filter, ignored when empty
+	CountryCode string
+
+	// Radius filter, used when HasRadius is true
+	HasRadius bool
+	Lat       float64
+	Long      float64
+	RadiusKm  float64
+
+	Limit int
+}
+
+// RefreshTrendingScores recomputes trending_score for every thread that has
+// recent activity or still carries a score from a previous run.
+//
+// The score rewards reply velocity (replies in the last hour count three
+// times), replies and distinct participants over the last day, and decays
+// with the age of the thread like a HN-style gravity ranking.
+func (m *ThreadModel) RefreshTrendingScores() error {
+	stmt := `WITH activity AS (
+	             SELECT thread_id,
+	                    COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 hour') AS hour_replies,
+	                    COUNT(*) AS day_replies,
+	                    COUNT(DISTINCT user_id) AS participants
+	             FROM messages
+	             WHERE created_at > NOW() - INTERVAL '24 hours' AND NOT is_first AND deleted_at IS NULL
+	               AND NOT held_for_review AND NOT shadow_hidden
+	             GROUP BY thread_id
+	         ),
+	         scores AS (
+	             SELECT threads.id,
+	                    COALESCE(
+	                        (3 * activity.hour_replies + activity.day_replies + 2 * activity.participants) /
+	                        POWER(EXTRACT(EPOCH FROM NOW() - threads.created_at) / 3600 + 2, 1.5),
+	                        0
+	                    ) AS score
+	             FROM threads
+	             LEFT JOIN activity ON activity.thread_id = threads.id
+	             WHERE activity.thread_id IS NOT NULL OR threads.trending_score <> 0
+	         )
+	         UPDATE threads SET trending_score = scores.score
+	         FROM scores
+	         WHERE scores.id = threads.id`
+
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// GetTrending returns the highest scoring threads, optionally limited to a
+// bounding box or a radius around a point. Scores are precomputed by
+// RefreshTrendingScores so this stays a cheap index scan.
+func (m *ThreadModel) GetTrending(query TrendingQuery) ([]*Thread, error) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	conditions = append(conditions, "trending_score > 0", "NOT held_for_review", "NOT shadow_hidden", "threads.deleted_at IS NULL")
+
+	if len(query.Boxes) > 0 {
+		where, boxArgs := boundsCondition(query.Boxes, argIndex)
+		conditions = append(conditions, where)
+		args = append(args, boxArgs...)
+		argIndex += len(boxArgs)
+	}
+
+	if query.HasRadius {
+		conditions = append(conditions, fmt.Sprintf(`(
+				6371 * acos(LEAST(1.0,
+					cos(radians($%[1]d)) * cos(radians(lat)) *
+					cos(radians(long) - radians($%[2]d)) +
+					sin(radians($%[1]d)) * sin(radians(lat))
+				))
+			 ) <= $%[3]d`, argIndex, argIndex+1, argIndex+2))
+		args = append(args, query.Lat, query.Long, query.RadiusKm)
+		argIndex += 3
+	}
+
+	if query.CountryCode != "" {
+		conditions = append(conditions, fmt.Sprintf("country_code = $%d", argIndex))
+		args = append(args, query.CountryCode)
+		argIndex++
+	}
+
+	stmt := `SELECT ` + threadColumns + `
+	         FROM threads
+	         INNER JOIN users ON users.id = threads.user_id
+	         WHERE ` + strings.Join(conditions, " AND ") +
+		fmt.Sprintf(" ORDER BY trending_score DESC LIMIT $%d", argIndex)
+	args = append(args, query.Limit)
+
+	return m.queryThreads(stmt, args...)
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"globechat.live/internal/geo"
+)
+
+// destination walks distanceKm from a point along bearing, in degrees
+// clockwise from north.
+func destination(lat, long, bearing, distanceKm float64) (float64, float64) {
+	toRad := math.Pi / 180
+	phi, lambda, theta := lat*toRad, long*toRad, bearing*toRad
+	delta := distanceKm / 6371
+
+	phi2 := math.Asin(math.Sin(phi)*math.Cos(delta) + math.Cos(phi)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi), math.Cos(delta)-math.Sin(phi)*math.Sin(phi2))
+
+	return phi2 / toRad, geo.NormalizeLong(lambda2 / toRad)
+}
+
+// Two threads closer than the spacing must never be created concurrently,
+// so they have to share at least one lock.
+func TestThreadLockKeysOverlapForNearbyThreads(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for range 100_000 {
+		limits := ThreadLimits{MinSpacingKm: math.Pow(10, r.Float64()*4-3)}
+
+		// Bias towards the poles and the antimeridian, where cells are odd
+		lat := r.Float64()*180 - 90
+		if r.Intn(4) == 0 {
+			lat = math.Copysign(90-r.Float64(), lat)
+		}
+		long := r.Float64()*360 - 180
+		if r.Intn(4) == 0 {
+			long = math.Copysign(180-r.Float64()*0.01, long)
+		}
+
+		otherLat, otherLong := destination(lat, long, r.Float64()*360, limits.MinSpacingKm*r.Float64())
+
+		a := threadLockKeys(lat, long, 1, limits)
+		b := threadLockKeys(otherLat, otherLong, 2, limits)
+
+		// Different users, so only a cell can be shared
+		if !slices.ContainsFunc(a, func(key int64) bool { return slices.Contains(b, key) }) {
+			t.Fatalf("(%g, %g) and (%g, %g) share no lock with %g km spacing", lat, long, otherLat, otherLong, limits.MinSpacingKm)
+		}
+
+		if !slices.IsSorted(a) || !slices.IsSorted(b) {
+			t.Fatal("keys aren't sorted")
+		}
+	}
+}
+
+func TestThreadLockKeysWithoutSpacing(t *testing.T) {
+	a := threadLockKeys(10, 10, 1, ThreadLimits{})
+	b := threadLockKeys(10, 10, 2, ThreadLimits{})
+
+	if len(a) != 1 || len(b) != 1 || a[0] == b[0] {
+		t.Errorf("got %v and %v, want one lock per user", a, b)
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	DeletedByAuthor    = "author"
+	DeletedByModerator = "moderator"
+)
+
+// Tombstone marks a soft deleted message or thread. DeletedById is only
+// kept for moderators and cleared by Redact.
+type Tombstone struct {
+	DeletedAt   time.Time `json:"deleted_at"`
+	By          string    `json:"by"`
+	DeletedById int       `json:"deleted_by_id,omitempty"`
+}
+
+// newTombstone builds the tombstone from the deleted_at and deleted_by
+// columns, nil when the row isn't deleted.
+func newTombstone(deletedAt sql.NullTime, deletedBy sql.NullInt64, authorId int) *Tombstone {
+	if !deletedAt.Valid {
+		return nil
+	}
+
+	tombstone := &Tombstone{
+		DeletedAt:   deletedAt.Time,
+		By:          DeletedByModerator,
+		DeletedById: int(deletedBy.Int64),
+	}
+
+	if deletedBy.Valid && int(deletedBy.Int64) == authorId {
+		tombstone.By = DeletedByAuthor
+	}
+
+	return tombstone
+}
+
+// Redact strips the content of a deleted message, leaving the tombstone in
+// its place.
+func (message *Message) Redact() {
+	if message.Deleted == nil {
+		return
+	}
+
+	message.Text = ""
+	message.Image = ""
+	message.Thumbnail = ""
+	message.Mentions = []Mention{}
+	message.Poll = nil
+	message.Reactions = map[string]Reaction{}
+	message.Previews = []LinkPreview{}
+	message.Deleted.DeletedById = 0
+}
+
+// Redact strips the content of a deleted thread, leaving the tombstone in
+// its place.
+func (thread *Thread) Redact() {
+	if thread.Deleted == nil {
+		return
+	}
+
+	thread.Message = ""
+	thread.Poll = nil
+	thread.Deleted.DeletedById = 0
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrUploadInUse = errors.New("upload is already attached to a message")
+
+// Upload is a re-encoded message image stored in the media directory.
+type Upload struct {
+	ID        string    `json:"id"`
+	UserId    int       `json:"user_id"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// URL is where the full size image is served from.
+func (u Upload) URL() string {
+	return fmt.Sprintf("/media/uploads/%s.jpg", u.ID)
+}
+
+// ThumbnailURL is where the small version of the image is served from.
+func (u Upload) ThumbnailURL() string {
+	return fmt.Sprintf("/media/uploads/%s_thumb.jpg", u.ID)
+}
+
+type UploadModel struct {
+	DB *sql.DB
+}
+
+func (m *UploadModel) Create(upload Upload) (Upload, error) {
+	stmt := `INSERT INTO uploads (id, user_id, width, height, size) VALUES($1, $2, $3, $4, $5)
+	         RETURNING created_at`
+
+	err := m.DB.QueryRow(stmt, upload.ID, upload.UserId, upload.Width, upload.Height, upload.Size).Scan(&upload.CreatedAt)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	return upload, nil
+}
+
+func (m *UploadModel) GetById(id string) (Upload, error) {
+	stmt := "SELECT id, user_id, width, height, size, created_at FROM uploads WHERE id = $1"
+
+	var upload Upload
+	err := m.DB.QueryRow(stmt, id).Scan(&upload.ID, &upload.UserId, &upload.Width, &upload.Height, &upload.Size, &upload.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Upload{}, ErrNoRecord
+		}
+		return Upload{}, err
+	}
+
+	return upload, nil
+}
+
+// DeleteUnused removes uploads older than before that no message uses,
+// returning their ids so the files can be removed too.
+func (m *UploadModel) DeleteUnused(before time.Time) ([]string, error) {
+	stmt := `DELETE FROM uploads
+	         WHERE created_at < $1
+	           AND NOT EXISTS (SELECT true FROM messages WHERE messages.upload_id = uploads.id)
+	         RETURNING id`
+
+	rows, err := m.DB.Query(stmt, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate
+// value in a unique column.
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
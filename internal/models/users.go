@@ -8,25 +8,30 @@ import (
 )
 
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	IsAdmin   bool      `json:"is_admin"`
-	Username  string    `json:"username"`
-	Image     string    `json:"image"`
-	Messages  int       `json:"messages"`
+	ID                int       `json:"id"`
+	Email             string    `json:"email"`
+	CreatedAt         time.Time `json:"created_at"`
+	IsAdmin           bool      `json:"is_admin"`
+	Username          string    `json:"username"`
+	Image             string    `json:"image"`
+	Messages          int       `json:"messages"`
+	LocationPrecision string    `json:"location_precision"`
+	MentionsEnabled   bool      `json:"mentions_enabled"`
 }
 
 type UserQuery struct {
 	Search    string
 	PageSize  int
 	PageIndex int
+	// Takes the place of PageIndex when set
+	Cursor *Cursor
 }
 
 type UserQueryResult struct {
 	Total int    `json:"total"`
 	Count int    `json:"count"`
 	Users []User `json:"users"`
+	Page
 }
 
 type UserModel struct {
@@ -34,7 +39,7 @@ type UserModel struct {
 }
 
 func (m *UserModel) Create(email string, username string) (User, error) {
-	stmt := "INSERT INTO users (email, username) VALUES($1, $2) RETURNING id, email, created_at, username, image, messages, is_admin"
+	stmt := "INSERT INTO users (email, username) VALUES($1, $2) RETURNING id, email, created_at, username, image, messages, is_admin, location_precision, mentions_enabled"
 
 	row := m.DB.QueryRow(stmt, email, username)
 
@@ -49,7 +54,7 @@ func (m *UserModel) Create(email string, username string) (User, error) {
 func (m *UserModel) getUserFromRow(row *sql.Row) (User, error) {
 	var u User
 
-	err := row.Scan(&u.ID, &u.Email, &u.CreatedAt, &u.Username, &u.Image, &u.Messages, &u.IsAdmin)
+	err := row.Scan(&u.ID, &u.Email, &u.CreatedAt, &u.Username, &u.Image, &u.Messages, &u.IsAdmin, &u.LocationPrecision, &u.MentionsEnabled)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -62,25 +67,25 @@ func (m *UserModel) getUserFromRow(row *sql.Row) (User, error) {
 }
 
 func (m *UserModel) GetById(userId int) (User, error) {
-	stmt := "SELECT id, email, created_at, username, image, messages, is_admin FROM users WHERE id = $1"
+	stmt := "SELECT id, email, created_at, username, image, messages, is_admin, location_precision, mentions_enabled FROM users WHERE id = $1"
 	row := m.DB.QueryRow(stmt, userId)
 	return m.getUserFromRow(row)
 }
 
 func (m *UserModel) GetByEmail(email string) (User, error) {
-	stmt := "SELECT id, email, created_at, username, image, messages, is_admin FROM users WHERE email = $1"
+	stmt := "SELECT id, email, created_at, username, image, messages, is_admin, location_precision, mentions_enabled FROM users WHERE email = $1"
 	row := m.DB.QueryRow(stmt, email)
 	return m.getUserFromRow(row)
 }
 
 func (m *UserModel) GetByUsername(username string) (User, error) {
-	stmt := "SELECT id, email, created_at, username, image, messages, is_admin FROM users WHERE username = $1"
+	stmt := "SELECT id, email, created_at, username, image, messages, is_admin, location_precision, mentions_enabled FROM users WHERE username = $1"
 	row := m.DB.QueryRow(stmt, username)
 	return m.getUserFromRow(row)
 }
 
 func (m *UserModel) GetFromSessionToken(token string) (User, error) {
-	stmt := `SELECT users.id, users.email, users.created_at, users.username, users.image, users.messages , is_admin
+	stmt := `SELECT users.id, users.email, users.created_at, users.username, users.image, users.messages, is_admin, location_precision, mentions_enabled
 	         FROM sessions 
 	         INNER JOIN users ON users.id = sessions.user_id 
 	         WHERE sessions.token = $1 AND sessions.expires_at > NOW()`
@@ -102,34 +107,40 @@ func (m *UserModel) UpdateImageAndUsername(userId int, image string, username st
 
 func (m *UserModel) Query(query UserQuery) (UserQueryResult, error) {
 	// Build the base query
-	baseStmt := `SELECT id, email, created_at, username, image, messages, is_admin FROM users`
+	baseStmt := `SELECT id, email, created_at, username, image, messages, is_admin, location_precision, mentions_enabled FROM users`
 	countStmt := `SELECT COUNT(*) FROM users`
 
-	var whereClause string
+	var conditions []string
 	var args []interface{}
 
 	// Add search condition if provided
 	if query.Search != "" {
-		whereClause = ` WHERE username ILIKE $1 OR email ILIKE $1`
+		conditions = append(conditions, `(username ILIKE $1 OR email ILIKE $1)`)
 		args = append(args, "%"+query.Search+"%")
 	}
 
 	// Get total count
 	var total int
-	countQuery := countStmt + whereClause
+	countQuery := countStmt + whereClause(conditions)
 	err := m.DB.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
 		return UserQueryResult{}, err
 	}
 
-	// Build the main query with pagination
-	mainQuery := baseStmt + whereClause + ` ORDER BY created_at DESC`
+	condition, arg, order := keyset(query.Cursor, "id", len(args)+1)
+	if condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+
+	// Build the main query with pagination, one extra row tells if there are more
+	mainQuery := baseStmt + whereClause(conditions) + ` ORDER BY ` + order
+	mainQuery += ` LIMIT $` + fmt.Sprintf("%d", len(args)+1)
+	args = append(args, query.PageSize+1)
 
-	// Add pagination
-	if query.PageSize > 0 {
-		offset := query.PageIndex * query.PageSize
-		mainQuery += ` LIMIT $` + fmt.Sprintf("%d", len(args)+1) + ` OFFSET $` + fmt.Sprintf("%d", len(args)+2)
-		args = append(args, query.PageSize, offset)
+	if query.Cursor == nil {
+		mainQuery += ` OFFSET $` + fmt.Sprintf("%d", len(args)+1)
+		args = append(args, query.PageIndex*query.PageSize)
 	}
 
 	// Execute the query
@@ -140,10 +151,10 @@ func (m *UserModel) Query(query UserQuery) (UserQueryResult, error) {
 	defer rows.Close()
 
 	// Scan results
-	var users []User
+	users := []User{}
 	for rows.Next() {
 		var u User
-		err := rows.Scan(&u.ID, &u.Email, &u.CreatedAt, &u.Username, &u.Image, &u.Messages, &u.IsAdmin)
+		err := rows.Scan(&u.ID, &u.Email, &u.CreatedAt, &u.Username, &u.Image, &u.Messages, &u.IsAdmin, &u.LocationPrecision, &u.MentionsEnabled)
 		if err != nil {
 			return UserQueryResult{}, err
 		}
@@ -154,10 +165,13 @@ func (m *UserModel) Query(query UserQuery) (UserQueryResult, error) {
 		return UserQueryResult{}, err
 	}
 
+	users, page := paginateFrom(users, query.PageSize, query.Cursor, query.PageIndex*query.PageSize, func(u User) int { return u.ID })
+
 	result := UserQueryResult{
 		Total: total,
 		Count: len(users),
 		Users: users,
+		Page:  page,
 	}
 
 	return result, nil
@@ -168,6 +182,18 @@ func (m *UserModel) UpdateImage(userId int, image string) error {
 	return err
 }
 
+func (m *UserModel) UpdateLocationPrecision(userId int, precision string) error {
+	stmt := "UPDATE users SET location_precision = $1 WHERE id = $2"
+	_, err := m.DB.Exec(stmt, precision, userId)
+	return err
+}
+
+func (m *UserModel) UpdateMentionsEnabled(userId int, enabled bool) error {
+	stmt := "UPDATE users SET mentions_enabled = $1 WHERE id = $2"
+	_, err := m.DB.Exec(stmt, enabled, userId)
+	return err
+}
+
 func (m *UserModel) UpdateMessages(userId int, messages int) error {
 	stmt := "UPDATE users SET messages = $1 WHERE id = $2"
 	_, err := m.DB.Exec(stmt, messages, userId)
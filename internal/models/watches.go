@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type WatchedThread struct {
+	Thread            *Thread `json:"thread"`
+	LastReadMessageId int     `json:"last_read_message_id"`
+	UnreadCount       int     `json:"unread_count"`
+}
+
+type WatchModel struct {
+	DB *sql.DB
+}
+
+// Watch starts following a thread. Everything already posted counts as read.
+// Watching a thread twice is a no-op.
+func (m *WatchModel) Watch(userId int, threadId int) error {
+	stmt := `INSERT INTO thread_watches (user_id, thread_id, last_read_message_id)
+	         VALUES($1, $2, (SELECT COALESCE(MAX(id), 0) FROM messages WHERE thread_id = $2))
+	         ON CONFLICT (user_id, thread_id) DO NOTHING`
+
+	_, err := m.DB.Exec(stmt, userId, threadId)
+	return err
+}
+
+func (m *WatchModel) Unwatch(userId int, threadId int) error {
+	stmt := "DELETE FROM thread_watches WHERE user_id = $1 AND thread_id = $2"
+
+	result, err := m.DB.Exec(stmt, userId, threadId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// MarkRead moves the read marker forward to messageId. The marker never
+// moves backwards, so reading older pages doesn't bring back unread
+// messages. Threads the user isn't watching are ignored.
+func (m *WatchModel) MarkRead(userId int, threadId int, messageId int) error {
+	stmt := `UPDATE thread_watches
+	         SET last_read_message_id = GREATEST(last_read_message_id, $3)
+	         WHERE user_id = $1 AND thread_id = $2`
+
+	_, err := m.DB.Exec(stmt, userId, threadId, messageId)
+	return err
+}
+
+// GetByUserId returns the watched threads with the number of messages others
+// posted after the read marker, most recently watched first. Message ids
+// only grow, so the count is a range scan on the (thread_id, id) index.
+// Held and shadowed threads stay listed for their owner only.
+func (m *WatchModel) GetByUserId(userId int) ([]WatchedThread, error) {
+	stmt := `SELECT ` + threadColumns + `, thread_watches.last_read_message_id,
+	                (SELECT COUNT(*) FROM messages
+	                 WHERE messages.thread_id = threads.id
+	                   AND messages.id > thread_watches.last_read_message_id
+	                   AND messages.deleted_at IS NULL
+	                   AND messages.user_id <> $1
+	                   AND NOT messages.held_for_review
+	                   AND NOT messages.shadow_hidden) AS unread_count
+	         FROM thread_watches
+	         INNER JOIN threads ON threads.id = thread_watches.thread_id
+	         INNER JOIN users ON users.id = threads.user_id
+	         WHERE thread_watches.user_id = $1 AND threads.deleted_at IS NULL
+	           AND ((NOT threads.held_for_review AND NOT threads.shadow_hidden) OR threads.user_id = $1)
+	         ORDER BY thread_watches.created_at DESC`
+
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watched := []WatchedThread{}
+	for rows.Next() {
+		var w WatchedThread
+		w.Thread, err = scanThread(rows, &w.LastReadMessageId, &w.UnreadCount)
+		if err != nil {
+			return nil, err
+		}
+		watched = append(watched, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	threads := make([]*Thread, len(watched))
+	for i, w := range watched {
+		threads[i] = w.Thread
+	}
+
+	if err = attachThreadPolls(m.DB, threads); err != nil {
+		return nil, err
+	}
+
+	return watched, nil
+}
@@ -0,0 +1,296 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"globechat.live/internal/geo"
+)
+
+const (
+	ZoneCircle  = "circle"
+	ZonePolygon = "polygon"
+)
+
+// Zone is an admin defined area with stricter posting rules.
+type Zone struct {
+	ID            int         `json:"id"`
+	Name          string      `json:"name"`
+	Kind          string      `json:"kind"`
+	CenterLat     float64     `json:"center_lat"`
+	CenterLong    float64     `json:"center_long"`
+	RadiusKm      float64     `json:"radius_km"`
+	Polygon       geo.Polygon `json:"polygon"`
+	NoNewThreads  bool        `json:"no_new_threads"`
+	ReadOnly      bool        `json:"read_only"`
+	ThreadLimit   int         `json:"thread_limit"`
+	RequireReview bool        `json:"require_review"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+// Contains reports whether the point is inside the zone.
+func (z Zone) Contains(lat, long float64) bool {
+	if z.Kind == ZoneCircle {
+		return geo.DistanceKm(z.CenterLat, z.CenterLong, lat, long) <= z.RadiusKm
+	}
+
+	return z.Polygon.Contains(lat, long)
+}
+
+func (z Zone) Bounds() geo.BoundingBox {
+	if z.Kind == ZoneCircle {
+		return geo.CircleBounds(z.CenterLat, z.CenterLong, z.RadiusKm)
+	}
+
+	return z.Polygon.Bounds()
+}
+
+// ZoneRules is the combination of the rules of every zone a point is in,
+// the strictest rule wins.
+type ZoneRules struct {
+	Zones         []Zone
+	NoNewThreads  bool
+	ReadOnly      bool
+	RequireReview bool
+}
+
+func mergeZoneRules(zones []Zone) ZoneRules {
+	rules := ZoneRules{Zones: zones}
+
+	for _, zone := range zones {
+		rules.NoNewThreads = rules.NoNewThreads || zone.NoNewThreads
+		rules.ReadOnly = rules.ReadOnly || zone.ReadOnly
+		rules.RequireReview = rules.RequireReview || zone.RequireReview
+	}
+
+	return rules
+}
+
+// Merge combines the rules of two points, zones both are in count once.
+func (r ZoneRules) Merge(other ZoneRules) ZoneRules {
+	zones := append([]Zone{}, r.Zones...)
+	for _, zone := range other.Zones {
+		seen := false
+		for _, existing := range r.Zones {
+			if existing.ID == zone.ID {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			zones = append(zones, zone)
+		}
+	}
+
+	return mergeZoneRules(zones)
+}
+
+// ExceededThreadLimit returns the first zone in which the user already has
+// as many threads as the zone allows.
+func (r ZoneRules) ExceededThreadLimit(userThreads []*Thread) (Zone, bool) {
+	for _, zone := range r.Zones {
+		if zone.ThreadLimit <= 0 {
+			continue
+		}
+
+		count := 0
+		for _, thread := range userThreads {
+			if zone.Contains(thread.Lat, thread.Long) {
+				count++
+			}
+		}
+
+		if count >= zone.ThreadLimit {
+			return zone, true
+		}
+	}
+
+	return Zone{}, false
+}
+
+type ZoneModel struct {
+	DB *sql.DB
+}
+
+const zoneColumns = `id, name, kind, center_lat, center_long, radius_km, polygon,
+	no_new_threads, read_only, thread_limit, require_review, created_at`
+
+func scanZone(row rowScanner) (Zone, error) {
+	var zone Zone
+	var polygon []byte
+
+	err := row.Scan(&zone.ID, &zone.Name, &zone.Kind, &zone.CenterLat, &zone.CenterLong, &zone.RadiusKm, &polygon,
+		&zone.NoNewThreads, &zone.ReadOnly, &zone.ThreadLimit, &zone.RequireReview, &zone.CreatedAt)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	if err := json.Unmarshal(polygon, &zone.Polygon); err != nil {
+		return Zone{}, err
+	}
+
+	return zone, nil
+}
+
+func (m *ZoneModel) queryZones(stmt string, args ...any) ([]Zone, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := []Zone{}
+	for rows.Next() {
+		zone, err := scanZone(rows)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+// polygonJSON encodes the polygon for the jsonb column, circles store an
+// empty list.
+func polygonJSON(polygon geo.Polygon) ([]byte, error) {
+	if polygon == nil {
+		polygon = geo.Polygon{}
+	}
+
+	return json.Marshal(polygon)
+}
+
+func (m *ZoneModel) Create(zone Zone) (Zone, error) {
+	return insertZone(m.DB, zone)
+}
+
+// CreateMany inserts all zones in one transaction, so either every zone is
+// created or none are.
+func (m *ZoneModel) CreateMany(zones []Zone) ([]Zone, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created := make([]Zone, 0, len(zones))
+	for _, zone := range zones {
+		zone, err := insertZone(tx, zone)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, zone)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func insertZone(db queryRower, zone Zone) (Zone, error) {
+	polygon, err := polygonJSON(zone.Polygon)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	box := zone.Bounds()
+
+	stmt := `INSERT INTO zones (name, kind, center_lat, center_long, radius_km, polygon,
+	                            min_lat, min_long, max_lat, max_long,
+	                            no_new_threads, read_only, thread_limit, require_review)
+	         VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	         RETURNING ` + zoneColumns
+
+	row := db.QueryRow(stmt, zone.Name, zone.Kind, zone.CenterLat, zone.CenterLong, zone.RadiusKm, polygon,
+		box.MinLat, box.MinLong, box.MaxLat, box.MaxLong,
+		zone.NoNewThreads, zone.ReadOnly, zone.ThreadLimit, zone.RequireReview)
+
+	return scanZone(row)
+}
+
+func (m *ZoneModel) Update(zone Zone) (Zone, error) {
+	polygon, err := polygonJSON(zone.Polygon)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	box := zone.Bounds()
+
+	stmt := `UPDATE zones SET name = $1, kind = $2, center_lat = $3, center_long = $4, radius_km = $5, polygon = $6,
+	                          min_lat = $7, min_long = $8, max_lat = $9, max_long = $10,
+	                          no_new_threads = $11, read_only = $12, thread_limit = $13, require_review = $14
+	         WHERE id = $15
+	         RETURNING ` + zoneColumns
+
+	row := m.DB.QueryRow(stmt, zone.Name, zone.Kind, zone.CenterLat, zone.CenterLong, zone.RadiusKm, polygon,
+		box.MinLat, box.MinLong, box.MaxLat, box.MaxLong,
+		zone.NoNewThreads, zone.ReadOnly, zone.ThreadLimit, zone.RequireReview, zone.ID)
+
+	zone, err = scanZone(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Zone{}, ErrNoRecord
+		}
+		return Zone{}, err
+	}
+
+	return zone, nil
+}
+
+func (m *ZoneModel) Delete(zoneId int) error {
+	result, err := m.DB.Exec("DELETE FROM zones WHERE id = $1", zoneId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *ZoneModel) GetAll() ([]Zone, error) {
+	return m.queryZones("SELECT " + zoneColumns + " FROM zones ORDER BY id")
+}
+
+// GetRules returns the combined rules of every zone containing the point.
+// Candidate zones are found by their bounding box, then checked exactly.
+func (m *ZoneModel) GetRules(lat, long float64) (ZoneRules, error) {
+	stmt := `SELECT ` + zoneColumns + `
+	         FROM zones
+	         WHERE $1 BETWEEN min_lat AND max_lat
+	           AND $2 BETWEEN min_long AND max_long`
+
+	candidates, err := m.queryZones(stmt, lat, long)
+	if err != nil {
+		return ZoneRules{}, err
+	}
+
+	var zones []Zone
+	for _, zone := range candidates {
+		if zone.Contains(lat, long) {
+			zones = append(zones, zone)
+		}
+	}
+
+	return mergeZoneRules(zones), nil
+}
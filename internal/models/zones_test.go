@@ -0,0 +1,20 @@
+package models
+
+import "testing"
+
+func TestZoneRulesMerge(t *testing.T) {
+	review := Zone{ID: 1, RequireReview: true}
+	closed := Zone{ID: 2, NoNewThreads: true}
+
+	snapped := mergeZoneRules([]Zone{review})
+	raw := mergeZoneRules([]Zone{review, closed})
+
+	rules := snapped.Merge(raw)
+	if !rules.RequireReview || !rules.NoNewThreads || rules.ReadOnly {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	if len(rules.Zones) != 2 || rules.Zones[0].ID != 1 || rules.Zones[1].ID != 2 {
+		t.Errorf("expected each zone once, got %+v", rules.Zones)
+	}
+}
@@ -0,0 +1,196 @@
+// Package mvt encodes point features as Mapbox Vector Tiles (spec v2.1).
+//
+// Only what the thread map needs is implemented: point geometries and
+// string, integer, float and bool attributes. The protobuf wire format is
+// written by hand to avoid pulling in a protobuf runtime.
+package mvt
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const DefaultExtent = 4096
+
+// Property is a single feature attribute. Value must be a string, bool,
+// int, int64, uint64 or float64.
+type Property struct {
+	Key   string
+	Value any
+}
+
+type feature struct {
+	id   uint64
+	tags []uint32
+	x, y int
+}
+
+// Layer collects point features sharing a key and value dictionary.
+type Layer struct {
+	Name   string
+	Extent uint32
+
+	features   []feature
+	keys       []string
+	keyIndex   map[string]uint32
+	values     []any
+	valueIndex map[any]uint32
+}
+
+func NewLayer(name string, extent uint32) *Layer {
+	return &Layer{
+		Name:       name,
+		Extent:     extent,
+		keyIndex:   make(map[string]uint32),
+		valueIndex: make(map[any]uint32),
+	}
+}
+
+// AddPoint adds a point at tile coordinates (x, y), where (0, 0) is the top
+// left corner and Extent the bottom right.
+func (l *Layer) AddPoint(id uint64, x, y int, properties ...Property) {
+	f := feature{id: id, x: x, y: y}
+
+	for _, p := range properties {
+		f.tags = append(f.tags, l.key(p.Key), l.value(p.Value))
+	}
+
+	l.features = append(l.features, f)
+}
+
+func (l *Layer) Len() int {
+	return len(l.features)
+}
+
+func (l *Layer) key(k string) uint32 {
+	if i, ok := l.keyIndex[k]; ok {
+		return i
+	}
+
+	i := uint32(len(l.keys))
+	l.keys = append(l.keys, k)
+	l.keyIndex[k] = i
+	return i
+}
+
+func (l *Layer) value(v any) uint32 {
+	// Normalise integer types so 1 and int64(1) share an entry
+	switch n := v.(type) {
+	case int:
+		v = int64(n)
+	case int32:
+		v = int64(n)
+	case uint32:
+		v = uint64(n)
+	}
+
+	if i, ok := l.valueIndex[v]; ok {
+		return i
+	}
+
+	i := uint32(len(l.values))
+	l.values = append(l.values, v)
+	l.valueIndex[v] = i
+	return i
+}
+
+// Encode serialises the layers as a vector tile.
+func Encode(layers ...*Layer) []byte {
+	var tile []byte
+	for _, l := range layers {
+		tile = appendBytes(tile, 3, l.encode())
+	}
+
+	return tile
+}
+
+func (l *Layer) encode() []byte {
+	var b []byte
+
+	b = appendVarintField(b, 15, 2) // version
+	b = appendBytes(b, 1, []byte(l.Name))
+
+	for _, f := range l.features {
+		b = appendBytes(b, 2, f.encode())
+	}
+
+	for _, k := range l.keys {
+		b = appendBytes(b, 3, []byte(k))
+	}
+
+	for _, v := range l.values {
+		b = appendBytes(b, 4, encodeValue(v))
+	}
+
+	b = appendVarintField(b, 5, uint64(l.Extent))
+
+	return b
+}
+
+func (f feature) encode() []byte {
+	var b []byte
+
+	b = appendVarintField(b, 1, f.id)
+
+	if len(f.tags) > 0 {
+		var tags []byte
+		for _, t := range f.tags {
+			tags = binary.AppendUvarint(tags, uint64(t))
+		}
+		b = appendBytes(b, 2, tags)
+	}
+
+	b = appendVarintField(b, 3, 1) // POINT
+
+	// A single MoveTo command with one point, relative to the origin
+	var geometry []byte
+	geometry = binary.AppendUvarint(geometry, 1|1<<3)
+	geometry = binary.AppendUvarint(geometry, zigzag(f.x))
+	geometry = binary.AppendUvarint(geometry, zigzag(f.y))
+	b = appendBytes(b, 4, geometry)
+
+	return b
+}
+
+func encodeValue(v any) []byte {
+	var b []byte
+
+	switch n := v.(type) {
+	case string:
+		b = appendBytes(b, 1, []byte(n))
+	case float64:
+		b = binary.AppendUvarint(b, 3<<3|1)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(n))
+	case int64:
+		b = appendVarintField(b, 6, zigzag64(n))
+	case uint64:
+		b = appendVarintField(b, 5, n)
+	case bool:
+		var i uint64
+		if n {
+			i = 1
+		}
+		b = appendVarintField(b, 7, i)
+	}
+
+	return b
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func zigzag(n int) uint64 {
+	return zigzag64(int64(n))
+}
+
+func zigzag64(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
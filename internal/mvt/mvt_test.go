@@ -0,0 +1,287 @@
+package mvt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// The decoder below understands just enough of the protobuf wire format to
+// read back what Encode writes, following the vector tile spec field numbers.
+
+type decodedLayer struct {
+	version  uint64
+	name     string
+	features []decodedFeature
+	keys     []string
+	values   []any
+	extent   uint64
+}
+
+type decodedFeature struct {
+	id       uint64
+	tags     []uint64
+	geomType uint64
+	geometry []uint64
+}
+
+type field struct {
+	number int
+	varint uint64
+	fixed  uint64
+	bytes  []byte
+}
+
+func readFields(t *testing.T, b []byte) []field {
+	t.Helper()
+
+	var fields []field
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad field key in % x", b)
+		}
+		b = b[n:]
+
+		f := field{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("bad varint for field %d", f.number)
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				t.Fatalf("short fixed64 for field %d", f.number)
+			}
+			f.fixed = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				t.Fatalf("bad length for field %d", f.number)
+			}
+			f.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d for field %d", key&7, f.number)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+func readPacked(t *testing.T, b []byte) []uint64 {
+	t.Helper()
+
+	var values []uint64
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad packed varint in % x", b)
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+
+	return values
+}
+
+func decode(t *testing.T, tile []byte) []decodedLayer {
+	t.Helper()
+
+	var layers []decodedLayer
+	for _, f := range readFields(t, tile) {
+		if f.number != 3 {
+			t.Fatalf("unexpected tile field %d", f.number)
+		}
+
+		var l decodedLayer
+		for _, lf := range readFields(t, f.bytes) {
+			switch lf.number {
+			case 15:
+				l.version = lf.varint
+			case 1:
+				l.name = string(lf.bytes)
+			case 2:
+				l.features = append(l.features, decodeFeature(t, lf.bytes))
+			case 3:
+				l.keys = append(l.keys, string(lf.bytes))
+			case 4:
+				l.values = append(l.values, decodeValue(t, lf.bytes))
+			case 5:
+				l.extent = lf.varint
+			default:
+				t.Fatalf("unexpected layer field %d", lf.number)
+			}
+		}
+		layers = append(layers, l)
+	}
+
+	return layers
+}
+
+func decodeFeature(t *testing.T, b []byte) decodedFeature {
+	t.Helper()
+
+	var f decodedFeature
+	for _, ff := range readFields(t, b) {
+		switch ff.number {
+		case 1:
+			f.id = ff.varint
+		case 2:
+			f.tags = readPacked(t, ff.bytes)
+		case 3:
+			f.geomType = ff.varint
+		case 4:
+			f.geometry = readPacked(t, ff.bytes)
+		default:
+			t.Fatalf("unexpected feature field %d", ff.number)
+		}
+	}
+
+	return f
+}
+
+func decodeValue(t *testing.T, b []byte) any {
+	t.Helper()
+
+	fields := readFields(t, b)
+	if len(fields) != 1 {
+		t.Fatalf("value has %d fields, want 1", len(fields))
+	}
+
+	f := fields[0]
+	switch f.number {
+	case 1:
+		return string(f.bytes)
+	case 3:
+		return math.Float64frombits(f.fixed)
+	case 5:
+		return f.varint
+	case 6:
+		return int64(f.varint>>1) ^ -int64(f.varint&1)
+	case 7:
+		return f.varint != 0
+	}
+
+	t.Fatalf("unexpected value field %d", f.number)
+	return nil
+}
+
+// point reads back the single MoveTo command of a point geometry.
+func (f decodedFeature) point(t *testing.T) (int, int) {
+	t.Helper()
+
+	if f.geomType != 1 || len(f.geometry) != 3 || f.geometry[0] != 1|1<<3 {
+		t.Fatalf("not a single point: type %d, geometry %v", f.geomType, f.geometry)
+	}
+
+	unzigzag := func(v uint64) int { return int(int64(v>>1) ^ -int64(v&1)) }
+	return unzigzag(f.geometry[1]), unzigzag(f.geometry[2])
+}
+
+// properties resolves the feature's tags against the layer dictionaries.
+func (l decodedLayer) properties(t *testing.T, f decodedFeature) map[string]any {
+	t.Helper()
+
+	if len(f.tags)%2 != 0 {
+		t.Fatalf("odd number of tags %v", f.tags)
+	}
+
+	properties := make(map[string]any)
+	for i := 0; i < len(f.tags); i += 2 {
+		k, v := f.tags[i], f.tags[i+1]
+		if k >= uint64(len(l.keys)) || v >= uint64(len(l.values)) {
+			t.Fatalf("tag %d/%d out of range", k, v)
+		}
+		properties[l.keys[k]] = l.values[v]
+	}
+
+	return properties
+}
+
+func TestEncodeGolden(t *testing.T) {
+	layer := NewLayer("a", DefaultExtent)
+	layer.AddPoint(1, 2, 3)
+
+	want := []byte{
+		0x1a, 0x13, // layer, 19 bytes
+		0x78, 0x02, // version 2
+		0x0a, 0x01, 'a', // name
+		0x12, 0x09, // feature, 9 bytes
+		0x08, 0x01, // id 1
+		0x18, 0x01, // POINT
+		0x22, 0x03, 0x09, 0x04, 0x06, // MoveTo(2, 3)
+		0x28, 0x80, 0x20, // extent 4096
+	}
+
+	if got := Encode(layer); !bytes.Equal(got, want) {
+		t.Errorf("got  % x\nwant % x", got, want)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	layer := NewLayer("threads", DefaultExtent)
+	layer.AddPoint(7, 10, 4000,
+		Property{Key: "title", Value: "hello"},
+		Property{Key: "replies", Value: 1},
+		Property{Key: "score", Value: 0.5},
+		Property{Key: "cluster", Value: true},
+	)
+	layer.AddPoint(1<<40, -20, 5000,
+		Property{Key: "replies", Value: int64(1)},
+		Property{Key: "delta", Value: -300},
+		Property{Key: "big", Value: uint64(math.MaxUint64)},
+		Property{Key: "cluster", Value: false},
+	)
+
+	layers := decode(t, Encode(layer, NewLayer("empty", 512)))
+	if len(layers) != 2 {
+		t.Fatalf("got %d layers, want 2", len(layers))
+	}
+
+	l := layers[0]
+	if l.version != 2 || l.name != "threads" || l.extent != DefaultExtent || len(l.features) != 2 {
+		t.Fatalf("unexpected layer %+v", l)
+	}
+
+	// 1 and int64(1) share one dictionary entry
+	if len(l.keys) != 6 || len(l.values) != 7 {
+		t.Errorf("got %d keys and %d values, want 6 and 7", len(l.keys), len(l.values))
+	}
+
+	tests := []struct {
+		id         uint64
+		x, y       int
+		properties map[string]any
+	}{
+		{7, 10, 4000, map[string]any{"title": "hello", "replies": int64(1), "score": 0.5, "cluster": true}},
+		{1 << 40, -20, 5000, map[string]any{"replies": int64(1), "delta": int64(-300), "big": uint64(math.MaxUint64), "cluster": false}},
+	}
+
+	for i, tt := range tests {
+		f := l.features[i]
+		if f.id != tt.id {
+			t.Errorf("feature %d: got id %d, want %d", i, f.id, tt.id)
+		}
+
+		if x, y := f.point(t); x != tt.x || y != tt.y {
+			t.Errorf("feature %d: got point (%d, %d), want (%d, %d)", i, x, y, tt.x, tt.y)
+		}
+
+		if got := l.properties(t, f); !reflect.DeepEqual(got, tt.properties) {
+			t.Errorf("feature %d: got properties %v, want %v", i, got, tt.properties)
+		}
+	}
+
+	empty := layers[1]
+	if empty.name != "empty" || empty.extent != 512 || len(empty.features) != 0 {
+		t.Errorf("unexpected empty layer %+v", empty)
+	}
+}
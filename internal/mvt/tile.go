@@ -0,0 +1,56 @@
+package mvt
+
+import (
+	"math"
+
+	"globechat.live/internal/geo"
+)
+
+// Tile identifies a web mercator tile.
+type Tile struct {
+	Z, X, Y int
+}
+
+// Valid reports whether the tile exists at its zoom level.
+func (t Tile) Valid() bool {
+	if t.Z < 0 || t.Z > 22 {
+		return false
+	}
+
+	n := 1 << t.Z
+	return t.X >= 0 && t.X < n && t.Y >= 0 && t.Y < n
+}
+
+// Bounds returns the lat/long area the tile covers.
+func (t Tile) Bounds() geo.BoundingBox {
+	n := float64(int(1) << t.Z)
+
+	return geo.BoundingBox{
+		MinLat:  tileLat(float64(t.Y+1), n),
+		MaxLat:  tileLat(float64(t.Y), n),
+		MinLong: float64(t.X)/n*360 - 180,
+		MaxLong: float64(t.X+1)/n*360 - 180,
+	}
+}
+
+// Project converts a coordinate to tile pixel coordinates for the given
+// extent. Points outside the tile project outside [0, extent].
+func (t Tile) Project(lat, long float64, extent uint32) (int, int) {
+	n := float64(int(1) << t.Z)
+
+	// Web mercator can't show the poles
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	latRad := lat * math.Pi / 180
+
+	worldX := (long + 180) / 360 * n
+	worldY := (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n
+
+	x := (worldX - float64(t.X)) * float64(extent)
+	y := (worldY - float64(t.Y)) * float64(extent)
+
+	return int(math.Round(x)), int(math.Round(y))
+}
+
+func tileLat(y, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
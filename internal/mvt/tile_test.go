@@ -0,0 +1,93 @@
+package mvt
+
+import (
+	"math"
+	"testing"
+)
+
+const mercatorMaxLat = 85.0511287798
+
+func TestTileValid(t *testing.T) {
+	tests := []struct {
+		tile  Tile
+		valid bool
+	}{
+		{Tile{0, 0, 0}, true},
+		{Tile{1, 1, 1}, true},
+		{Tile{22, 1<<22 - 1, 0}, true},
+		{Tile{0, 1, 0}, false},
+		{Tile{1, 0, 2}, false},
+		{Tile{3, -1, 0}, false},
+		{Tile{-1, 0, 0}, false},
+		{Tile{23, 0, 0}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.tile.Valid(); got != tt.valid {
+			t.Errorf("%+v.Valid() = %v, want %v", tt.tile, got, tt.valid)
+		}
+	}
+}
+
+func TestTileBounds(t *testing.T) {
+	tests := []struct {
+		tile                             Tile
+		minLat, maxLat, minLong, maxLong float64
+	}{
+		{Tile{0, 0, 0}, -mercatorMaxLat, mercatorMaxLat, -180, 180},
+		{Tile{1, 0, 0}, 0, mercatorMaxLat, -180, 0},
+		{Tile{1, 1, 1}, -mercatorMaxLat, 0, 0, 180},
+		{Tile{2, 2, 1}, 0, 66.5132604431, 0, 90},
+	}
+
+	for _, tt := range tests {
+		b := tt.tile.Bounds()
+		for _, c := range []struct{ got, want float64 }{
+			{b.MinLat, tt.minLat}, {b.MaxLat, tt.maxLat}, {b.MinLong, tt.minLong}, {b.MaxLong, tt.maxLong},
+		} {
+			if math.Abs(c.got-c.want) > 1e-9 {
+				t.Errorf("%+v.Bounds() = %+v", tt.tile, b)
+				break
+			}
+		}
+	}
+}
+
+// The corners of a tile's bounds project onto the corners of the tile.
+func TestTileProjectCorners(t *testing.T) {
+	for _, tile := range []Tile{{0, 0, 0}, {1, 1, 0}, {5, 17, 9}, {12, 2047, 1362}, {18, 131071, 87155}} {
+		b := tile.Bounds()
+
+		if x, y := tile.Project(b.MaxLat, b.MinLong, DefaultExtent); x != 0 || y != 0 {
+			t.Errorf("%+v: top left projects to (%d, %d)", tile, x, y)
+		}
+
+		if x, y := tile.Project(b.MinLat, b.MaxLong, DefaultExtent); x != DefaultExtent || y != DefaultExtent {
+			t.Errorf("%+v: bottom right projects to (%d, %d)", tile, x, y)
+		}
+
+		midLong := (b.MinLong + b.MaxLong) / 2
+		if x, _ := tile.Project(b.MaxLat, midLong, DefaultExtent); x != DefaultExtent/2 {
+			t.Errorf("%+v: middle projects to x %d", tile, x)
+		}
+	}
+}
+
+func TestTileProjectOutside(t *testing.T) {
+	tile := Tile{1, 1, 0}
+
+	// A point in the western hemisphere is left of the tile
+	if x, _ := tile.Project(45, -90, DefaultExtent); x >= 0 {
+		t.Errorf("got x %d, want negative", x)
+	}
+
+	// A point in the southern hemisphere is below it
+	if _, y := tile.Project(-45, 90, DefaultExtent); y <= DefaultExtent {
+		t.Errorf("got y %d, want more than the extent", y)
+	}
+
+	// The poles are clamped to the edge of the map
+	if _, y := tile.Project(90, 90, DefaultExtent); y != 0 {
+		t.Errorf("north pole projects to y %d, want 0", y)
+	}
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Policy allows Requests per Per, all of which can be used at once. The
+// zero Policy doesn't limit anything.
+type Policy struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParsePolicy reads a policy written like "5/10s", or "off" for no limit.
+func ParsePolicy(s string) (Policy, error) {
+	if s == "off" {
+		return Policy{}, nil
+	}
+
+	requests, per, ok := strings.Cut(s, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("rate limit must look like 5/10s or be off")
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Policy{}, fmt.Errorf("rate limit requests must be a positive number")
+	}
+
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Policy{}, fmt.Errorf("rate limit interval must be a positive duration like 10s")
+	}
+
+	return Policy{Requests: n, Per: d}, nil
+}
+
+func (p Policy) String() string {
+	if p.Requests == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", p.Requests, p.Per)
+}
+
+type bucketKey struct {
+	action string
+	key    string
+}
+
+// Limiter keeps a token bucket per action and key, like a user or an IP
+// address. It is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	policies map[string]Policy
+	buckets  map[bucketKey]*rate.Limiter
+}
+
+func New(policies map[string]Policy) *Limiter {
+	return &Limiter{
+		policies: policies,
+		buckets:  make(map[bucketKey]*rate.Limiter),
+	}
+}
+
+// Allow takes a token from the bucket of action for each of keys. When any
+// of them is empty no token is taken and it returns the longest wait until
+// all of them have one instead. Actions without a policy are always allowed.
+func (l *Limiter) Allow(action string, keys ...string) (time.Duration, bool) {
+	policy := l.policies[action]
+	if policy.Requests == 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(keys))
+	var wait time.Duration
+
+	for _, key := range keys {
+		k := bucketKey{action, key}
+		bucket, ok := l.buckets[k]
+		if !ok {
+			bucket = rate.NewLimiter(rate.Every(policy.Per/time.Duration(policy.Requests)), policy.Requests)
+			l.buckets[k] = bucket
+		}
+
+		reservation := bucket.ReserveN(now, 1)
+		reservations = append(reservations, reservation)
+		wait = max(wait, reservation.DelayFrom(now))
+	}
+
+	if wait > 0 {
+		for _, reservation := range reservations {
+			reservation.CancelAt(now)
+		}
+		return wait, false
+	}
+
+	return 0, true
+}
+
+// Prune forgets buckets that have refilled completely, they behave the same
+// as new ones. It returns how many were removed.
+func (l *Limiter) Prune() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pruned := 0
+	for k, bucket := range l.buckets {
+		if bucket.Tokens() >= float64(bucket.Burst()) {
+			delete(l.buckets, k)
+			pruned++
+		}
+	}
+
+	return pruned
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Policy
+		ok   bool
+	}{
+		{"5/10s", Policy{Requests: 5, Per: 10 * time.Second}, true},
+		{"1/1h", Policy{Requests: 1, Per: time.Hour}, true},
+		{"off", Policy{}, true},
+		{"5", Policy{}, false},
+		{"0/10s", Policy{}, false},
+		{"-1/10s", Policy{}, false},
+		{"x/10s", Policy{}, false},
+		{"5/10", Policy{}, false},
+		{"5/0s", Policy{}, false},
+		{"5/-1s", Policy{}, false},
+		{"", Policy{}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePolicy(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParsePolicy(%q) = %+v, %v", tt.s, got, err)
+		}
+	}
+}
+
+func TestPolicyStringRoundTrips(t *testing.T) {
+	for _, s := range []string{"5/10s", "off", "3/1h0m0s"} {
+		p, err := ParsePolicy(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.String() != s {
+			t.Errorf("ParsePolicy(%q).String() = %q", s, p.String())
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	l := New(map[string]Policy{"post": {Requests: 2, Per: time.Hour}})
+
+	for i := range 2 {
+		if _, ok := l.Allow("post", "a"); !ok {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+
+	wait, ok := l.Allow("post", "a")
+	if ok {
+		t.Fatal("third request was allowed")
+	}
+
+	// The burst refills one request every half hour
+	if wait <= 29*time.Minute || wait > 30*time.Minute {
+		t.Errorf("got wait %s, want about 30m", wait)
+	}
+
+	if _, ok := l.Allow("post", "b"); !ok {
+		t.Error("another key was limited")
+	}
+
+	if _, ok := l.Allow("other", "a"); !ok {
+		t.Error("an action without a policy was limited")
+	}
+}
+
+func TestAllowChecksEveryKey(t *testing.T) {
+	l := New(map[string]Policy{"post": {Requests: 2, Per: time.Hour}})
+
+	l.Allow("post", "a")
+	l.Allow("post", "a")
+
+	wait, ok := l.Allow("post", "a", "b")
+	if ok || wait <= 0 {
+		t.Fatalf("got %s, %v with one key empty", wait, ok)
+	}
+
+	// The denied request must not have used up b's tokens
+	for i := range 2 {
+		if _, ok := l.Allow("post", "b"); !ok {
+			t.Fatalf("request %d for b was limited", i+1)
+		}
+	}
+
+}
+
+func TestAllowReturnsTheLongestWait(t *testing.T) {
+	l := New(map[string]Policy{"post": {Requests: 1, Per: time.Hour}})
+
+	l.Allow("post", "a")
+	time.Sleep(20 * time.Millisecond)
+	l.Allow("post", "b")
+
+	waitA, _ := l.Allow("post", "a")
+	wait, ok := l.Allow("post", "a", "b")
+	if ok || wait <= waitA {
+		t.Errorf("got %s, %v, want longer than a's %s", wait, ok, waitA)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l := New(map[string]Policy{"post": {Requests: 2, Per: 20 * time.Millisecond}})
+
+	l.Allow("post", "a")
+	l.Allow("post", "b")
+
+	if n := l.Prune(); n != 0 {
+		t.Errorf("pruned %d buckets that aren't full", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if n := l.Prune(); n != 2 {
+		t.Errorf("pruned %d buckets, want 2", n)
+	}
+
+	if len(l.buckets) != 0 {
+		t.Errorf("%d buckets left", len(l.buckets))
+	}
+}
@@ -0,0 +1,50 @@
+package unfurl
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// MaxLinks is how many links of a single message get previews.
+const MaxLinks = 3
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// ExtractURLs returns the distinct http(s) links in text, in order of
+// appearance and at most MaxLinks of them.
+func ExtractURLs(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+
+	for _, match := range urlPattern.FindAllString(text, -1) {
+		// Punctuation right after a link usually belongs to the sentence, and
+		// so do closing parentheses that weren't opened in the link
+		for {
+			trimmed := strings.TrimRight(match, ".,;:!?'")
+			if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, ")") > strings.Count(trimmed, "(") {
+				trimmed = trimmed[:len(trimmed)-1]
+			}
+			if trimmed == match {
+				break
+			}
+			match = trimmed
+		}
+
+		u, err := url.Parse(match)
+		if err != nil || u.Host == "" {
+			continue
+		}
+
+		if !seen[match] {
+			seen[match] = true
+			urls = append(urls, match)
+		}
+
+		if len(urls) == MaxLinks {
+			break
+		}
+	}
+
+	return urls
+}
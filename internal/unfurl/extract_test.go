@@ -0,0 +1,34 @@
+package unfurl
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"no links here", nil},
+		{"see https://example.com.", []string{"https://example.com"}},
+		{"really? https://example.com/a?b=1!?", []string{"https://example.com/a?b=1"}},
+		{"quoted 'https://example.com/x',", []string{"https://example.com/x"}},
+		{"(see https://example.com/page)", []string{"https://example.com/page"}},
+		{"https://en.wikipedia.org/wiki/Go_(programming_language)", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{"(https://en.wikipedia.org/wiki/Go_(programming_language)).", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{"http://a.com and http://a.com again", []string{"http://a.com"}},
+		{"ftp://example.com and mailto:me@example.com", nil},
+		{"https://// is not a link", nil},
+		{
+			"https://1.com https://2.com https://3.com https://4.com",
+			[]string{"https://1.com", "https://2.com", "https://3.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := ExtractURLs(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("ExtractURLs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
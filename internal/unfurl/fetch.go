@@ -0,0 +1,188 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrBlockedAddress = errors.New("unfurl: address is not publicly routable")
+	ErrUnsupported    = errors.New("unfurl: unsupported content")
+)
+
+// Fetcher loads the preview of a link.
+type Fetcher interface {
+	Fetch(ctx context.Context, link string) (Preview, error)
+}
+
+// HTTPFetcher fetches pages over HTTP and reads their metadata. It refuses
+// to connect to private, loopback and other non public addresses, checked
+// after DNS resolution and on every redirect.
+type HTTPFetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultMaxBytes = 512 << 10 // metadata lives in the head, the rest is ignored
+	maxRedirects    = 3
+	userAgent       = "globechat-unfurl/1.0 (+https://globechat.live)"
+)
+
+// NewHTTPFetcher returns a fetcher giving up on a link after timeout and
+// reading at most maxBytes of each page. allowPrivate turns off the address
+// checks so tests can use a local server.
+func NewHTTPFetcher(timeout time.Duration, maxBytes int64, allowPrivate bool) *HTTPFetcher {
+	allowed := isPublic
+	if allowPrivate {
+		allowed = nil
+	}
+
+	return newHTTPFetcher(timeout, maxBytes, allowed)
+}
+
+// newHTTPFetcher only connects to addresses allowed accepts, or anywhere
+// when it is nil.
+func newHTTPFetcher(timeout time.Duration, maxBytes int64, allowed func(netip.Addr) bool) *HTTPFetcher {
+	dialer := &net.Dialer{Timeout: timeout}
+	if allowed != nil {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !allowed(addr) {
+				return ErrBlockedAddress
+			}
+
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		// Never go through a proxy, it would hide the real destination
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &HTTPFetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("unfurl: stopped after %d redirects", maxRedirects)
+				}
+				return checkScheme(req.URL)
+			},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, link string) (Preview, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	if err = checkScheme(u); err != nil {
+		return Preview{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Preview{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,image/*;q=0.8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("unfurl: %s returned %s", link, resp.Status)
+	}
+
+	// The page may have redirected, relative links are resolved against
+	// where it ended up
+	final := resp.Request.URL
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return Preview{URL: final.String(), Image: final.String()}, nil
+	case mediaType != "text/html" && mediaType != "application/xhtml+xml":
+		return Preview{}, ErrUnsupported
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return Preview{}, err
+	}
+
+	preview := parseMeta(string(body), final)
+	if preview.Empty() {
+		return Preview{}, ErrUnsupported
+	}
+
+	return preview, nil
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unfurl: unsupported scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// Ranges that aren't covered by the netip helpers but still aren't reachable
+// on the public internet.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
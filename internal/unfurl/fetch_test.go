@@ -0,0 +1,178 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func servePage(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}
+}
+
+func TestFetchReadsMetadata(t *testing.T) {
+	server := serve(t, servePage(`<html><head><meta property="og:title" content="Hello"></head></html>`))
+
+	f := NewHTTPFetcher(time.Second, DefaultMaxBytes, true)
+	preview, err := f.Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.Title != "Hello" || preview.URL != server.URL {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+}
+
+func TestFetchStopsReadingAtMaxBytes(t *testing.T) {
+	padding := "<!--" + strings.Repeat("x", DefaultMaxBytes) + "-->"
+	server := serve(t, servePage(`<html><head>`+padding+`<meta property="og:title" content="Too late"></head></html>`))
+
+	f := NewHTTPFetcher(time.Second, DefaultMaxBytes, true)
+	_, err := f.Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestFetchTimesOut(t *testing.T) {
+	server := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	f := NewHTTPFetcher(50*time.Millisecond, DefaultMaxBytes, true)
+
+	start := time.Now()
+	_, err := f.Fetch(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetch took %s, the timeout was ignored", elapsed)
+	}
+}
+
+func TestFetchRejectsOtherContent(t *testing.T) {
+	server := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		fmt.Fprint(w, "%PDF-1.7")
+	})
+
+	f := NewHTTPFetcher(time.Second, DefaultMaxBytes, true)
+	if _, err := f.Fetch(context.Background(), server.URL); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestFetchBlocksLoopback(t *testing.T) {
+	server := serve(t, servePage(`<title>Internal</title>`))
+
+	f := NewHTTPFetcher(time.Second, DefaultMaxBytes, false)
+	if _, err := f.Fetch(context.Background(), server.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("got %v, want ErrBlockedAddress", err)
+	}
+}
+
+// The first hop is on 127.0.0.2, which the test treats as public, and
+// redirects to a server on 127.0.0.1 that must never be contacted.
+func TestFetchBlocksRedirectToLoopback(t *testing.T) {
+	var contacted atomic.Bool
+	internal := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		contacted.Store(true)
+		servePage(`<title>Internal</title>`)(w, r)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("can't listen on 127.0.0.2: %v", err)
+	}
+
+	public := httptest.NewUnstartedServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	public.Listener.Close()
+	public.Listener = listener
+	public.Start()
+	t.Cleanup(public.Close)
+
+	loopback := netip.MustParseAddr("127.0.0.1")
+	f := newHTTPFetcher(time.Second, DefaultMaxBytes, func(addr netip.Addr) bool { return addr != loopback })
+
+	if _, err := f.Fetch(context.Background(), public.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("got %v, want ErrBlockedAddress", err)
+	}
+
+	if contacted.Load() {
+		t.Error("the redirect target was contacted")
+	}
+}
+
+func TestFetchRejectsOtherSchemes(t *testing.T) {
+	f := NewHTTPFetcher(time.Second, DefaultMaxBytes, false)
+
+	for _, link := range []string{"file:///etc/passwd", "ftp://example.com/", "gopher://example.com/"} {
+		if _, err := f.Fetch(context.Background(), link); err == nil {
+			t.Errorf("%s: expected an error", link)
+		}
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"192.0.0.8", false},
+		{"192.0.2.1", false},
+		{"198.18.0.1", false},
+		{"198.51.100.1", false},
+		{"203.0.113.1", false},
+		{"224.0.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"64:ff9b::7f00:1", false},
+		{"2001:db8::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublic(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("isPublic(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
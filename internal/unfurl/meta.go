@@ -0,0 +1,104 @@
+package unfurl
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Preview is the metadata shown for a link.
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+}
+
+// Empty reports whether there is nothing worth showing.
+func (p Preview) Empty() bool {
+	return p.Title == "" && p.Description == "" && p.Image == ""
+}
+
+var (
+	metaPattern  = regexp.MustCompile(`(?is)<meta\s+([^>]*)>`)
+	attrPattern  = regexp.MustCompile(`(?s)([a-zA-Z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+const (
+	maxTitleLen       = 200
+	maxDescriptionLen = 500
+)
+
+// parseMeta reads OpenGraph and Twitter card tags from an HTML document,
+// falling back to the plain title and description. Relative image links are
+// resolved against base.
+func parseMeta(document string, base *url.URL) Preview {
+	meta := make(map[string]string)
+
+	for _, tag := range metaPattern.FindAllStringSubmatch(document, -1) {
+		attrs := make(map[string]string)
+		for _, attr := range attrPattern.FindAllStringSubmatch(tag[1], -1) {
+			attrs[strings.ToLower(attr[1])] = attr[2] + attr[3] + attr[4]
+		}
+
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+
+		// The first value wins, like in most unfurlers
+		if _, ok := meta[key]; key != "" && !ok {
+			meta[key] = clean(attrs["content"])
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if meta[key] != "" {
+				return meta[key]
+			}
+		}
+		return ""
+	}
+
+	preview := Preview{
+		URL:         base.String(),
+		Title:       first("og:title", "twitter:title"),
+		Description: first("og:description", "twitter:description", "description"),
+		SiteName:    first("og:site_name", "application-name"),
+	}
+
+	if preview.Title == "" {
+		if match := titlePattern.FindStringSubmatch(document); match != nil {
+			preview.Title = clean(match[1])
+		}
+	}
+
+	if image := first("og:image:secure_url", "og:image", "twitter:image", "twitter:image:src"); image != "" {
+		if u, err := base.Parse(image); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			preview.Image = u.String()
+		}
+	}
+
+	preview.Title = truncate(preview.Title, maxTitleLen)
+	preview.Description = truncate(preview.Description, maxDescriptionLen)
+	preview.SiteName = truncate(preview.SiteName, maxTitleLen)
+
+	return preview
+}
+
+func clean(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,93 @@
+package unfurl
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseMeta(t *testing.T) {
+	base, _ := url.Parse("https://example.com/articles/1")
+
+	tests := []struct {
+		name     string
+		document string
+		want     Preview
+	}{
+		{
+			name: "OpenGraph",
+			document: `<head>
+				<meta property="og:title" content="OG title">
+				<meta property="og:description" content="OG description">
+				<meta property="og:image" content="/images/cover.png">
+				<meta property="og:site_name" content="Example">
+				<title>Page title</title>
+			</head>`,
+			want: Preview{
+				URL:         "https://example.com/articles/1",
+				Title:       "OG title",
+				Description: "OG description",
+				Image:       "https://example.com/images/cover.png",
+				SiteName:    "Example",
+			},
+		},
+		{
+			name: "Twitter card",
+			document: `<meta name="twitter:title" content='Card title'>
+				<meta name="twitter:description" content="Card description">
+				<meta name="twitter:image" content="https://cdn.example.com/card.jpg">`,
+			want: Preview{
+				URL:         "https://example.com/articles/1",
+				Title:       "Card title",
+				Description: "Card description",
+				Image:       "https://cdn.example.com/card.jpg",
+			},
+		},
+		{
+			name: "OpenGraph wins over Twitter",
+			document: `<meta name="twitter:title" content="Card title">
+				<meta property="og:title" content="OG title">`,
+			want: Preview{URL: "https://example.com/articles/1", Title: "OG title"},
+		},
+		{
+			name: "title and description fallback",
+			document: `<TITLE>
+				Plain &amp; simple
+			</TITLE>
+			<meta name="description" content="Plain description">`,
+			want: Preview{
+				URL:         "https://example.com/articles/1",
+				Title:       "Plain & simple",
+				Description: "Plain description",
+			},
+		},
+		{
+			name:     "unsafe image scheme",
+			document: `<meta property="og:image" content="javascript:alert(1)"><title>x</title>`,
+			want:     Preview{URL: "https://example.com/articles/1", Title: "x"},
+		},
+		{
+			name:     "nothing",
+			document: `<html><body>hi</body></html>`,
+			want:     Preview{URL: "https://example.com/articles/1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMeta(tt.document, base); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMetaTruncates(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	long := strings.Repeat("é", maxTitleLen+50)
+
+	preview := parseMeta(`<meta property="og:title" content="`+long+`">`, base)
+	if n := len([]rune(preview.Title)); n != maxTitleLen {
+		t.Errorf("title has %d runes, want %d", n, maxTitleLen)
+	}
+}
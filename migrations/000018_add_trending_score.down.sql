@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS threads_trending_score_idx;
+ALTER TABLE threads DROP COLUMN trending_score;
@@ -0,0 +1,2 @@
+ALTER TABLE threads ADD COLUMN trending_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+CREATE INDEX threads_trending_score_idx ON threads (trending_score DESC);
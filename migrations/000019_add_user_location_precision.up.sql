@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN location_precision TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS threads_country_code_idx;
+
+ALTER TABLE threads
+DROP COLUMN place_name,
+DROP COLUMN country_code;
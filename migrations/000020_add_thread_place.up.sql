@@ -0,0 +1,5 @@
+ALTER TABLE threads
+ADD COLUMN place_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN country_code TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX threads_country_code_idx ON threads (country_code);
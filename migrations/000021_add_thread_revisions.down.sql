@@ -0,0 +1,2 @@
+DROP TABLE thread_revisions;
+ALTER TABLE threads DROP COLUMN edited_at;
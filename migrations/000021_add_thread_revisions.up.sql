@@ -0,0 +1,14 @@
+ALTER TABLE threads ADD COLUMN edited_at TIMESTAMPTZ;
+
+CREATE TABLE thread_revisions (
+    id SERIAL PRIMARY KEY,
+    thread_id INT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    edited_by INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE,
+    FOREIGN KEY (edited_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX thread_revisions_thread_id_idx ON thread_revisions (thread_id);
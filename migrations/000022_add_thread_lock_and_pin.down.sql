@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS threads_pinned_idx;
+
+ALTER TABLE threads
+DROP COLUMN locked,
+DROP COLUMN pinned;
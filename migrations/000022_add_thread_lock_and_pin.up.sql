@@ -0,0 +1,5 @@
+ALTER TABLE threads
+ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX threads_pinned_idx ON threads (lat, long) WHERE pinned;
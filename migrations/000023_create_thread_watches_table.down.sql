@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messages_thread_id_id_idx;
+DROP TABLE thread_watches;
@@ -0,0 +1,12 @@
+CREATE TABLE thread_watches (
+    user_id INT NOT NULL,
+    thread_id INT NOT NULL,
+    last_read_message_id INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (user_id, thread_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_thread_id_id_idx ON messages (thread_id, id);
@@ -0,0 +1 @@
+ALTER TABLE threads DROP COLUMN last_activity_at;
@@ -0,0 +1,9 @@
+ALTER TABLE threads ADD COLUMN last_activity_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE threads SET
+    replies = (SELECT COUNT(*) FROM messages WHERE messages.thread_id = threads.id AND NOT messages.is_first),
+    last_activity_at = COALESCE(
+        (SELECT MAX(created_at) FROM messages WHERE messages.thread_id = threads.id),
+        threads.created_at,
+        CURRENT_TIMESTAMP
+    );
@@ -0,0 +1,2 @@
+ALTER TABLE threads DROP COLUMN held_for_review;
+DROP TABLE zones;
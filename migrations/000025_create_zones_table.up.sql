@@ -0,0 +1,26 @@
+CREATE TABLE zones (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL CHECK (kind IN ('circle', 'polygon')),
+    center_lat DOUBLE PRECISION NOT NULL DEFAULT 0,
+    center_long DOUBLE PRECISION NOT NULL DEFAULT 0,
+    radius_km DOUBLE PRECISION NOT NULL DEFAULT 0,
+    polygon JSONB NOT NULL DEFAULT '[]',
+
+    -- Bounding box used to find candidate zones before the exact check
+    min_lat DOUBLE PRECISION NOT NULL,
+    min_long DOUBLE PRECISION NOT NULL,
+    max_lat DOUBLE PRECISION NOT NULL,
+    max_long DOUBLE PRECISION NOT NULL,
+
+    no_new_threads BOOLEAN NOT NULL DEFAULT FALSE,
+    read_only BOOLEAN NOT NULL DEFAULT FALSE,
+    thread_limit INT NOT NULL DEFAULT 0,
+    require_review BOOLEAN NOT NULL DEFAULT FALSE,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX zones_bounds_idx ON zones (min_lat, max_lat, min_long, max_long);
+
+ALTER TABLE threads ADD COLUMN held_for_review BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS threads_random_key_idx;
+ALTER TABLE threads DROP COLUMN random_key;
@@ -0,0 +1,2 @@
+ALTER TABLE threads ADD COLUMN random_key DOUBLE PRECISION NOT NULL DEFAULT random();
+CREATE INDEX threads_random_key_idx ON threads (random_key) WHERE NOT held_for_review;
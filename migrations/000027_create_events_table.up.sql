@@ -0,0 +1,24 @@
+CREATE TABLE events (
+    thread_id INT PRIMARY KEY,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    -- IANA name of the zone the event was scheduled in, for display
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    ended BOOLEAN NOT NULL DEFAULT FALSE,
+
+    CHECK (ends_at > starts_at),
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
+
+CREATE INDEX events_starts_at_idx ON events (starts_at);
+CREATE INDEX events_pending_end_idx ON events (ends_at) WHERE NOT ended;
+
+CREATE TABLE event_rsvps (
+    thread_id INT NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (thread_id, user_id),
+    FOREIGN KEY (thread_id) REFERENCES events(thread_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,39 @@
+-- A poll belongs to a thread, or to a message in it when message_id is set
+CREATE TABLE polls (
+    id SERIAL PRIMARY KEY,
+    thread_id INT NOT NULL,
+    message_id INT UNIQUE,
+    question TEXT NOT NULL DEFAULT '',
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX polls_thread_id_idx ON polls (thread_id) WHERE message_id IS NULL;
+
+CREATE TABLE poll_options (
+    id SERIAL PRIMARY KEY,
+    poll_id INT NOT NULL,
+    position INT NOT NULL,
+    text TEXT NOT NULL,
+
+    UNIQUE (poll_id, position),
+    FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_votes (
+    poll_id INT NOT NULL,
+    option_id INT NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (poll_id, user_id, option_id),
+    FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE,
+    FOREIGN KEY (option_id) REFERENCES poll_options(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX poll_votes_option_id_idx ON poll_votes (option_id);
@@ -0,0 +1,14 @@
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMPTZ;
+
+CREATE TABLE message_revisions (
+    id SERIAL PRIMARY KEY,
+    message_id INT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    edited_by INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (edited_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX message_revisions_message_id_idx ON message_revisions (message_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messages_reply_to_id_idx;
+ALTER TABLE messages DROP COLUMN reply_to_id;
@@ -0,0 +1,5 @@
+-- No foreign key: replies keep pointing at a deleted parent so it can be
+-- shown as a tombstone
+ALTER TABLE messages ADD COLUMN reply_to_id INT;
+
+CREATE INDEX messages_reply_to_id_idx ON messages (reply_to_id) WHERE reply_to_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS notifications;
+ALTER TABLE messages DROP COLUMN mentions;
+ALTER TABLE users DROP COLUMN mentions_enabled;
@@ -0,0 +1,23 @@
+ALTER TABLE users ADD COLUMN mentions_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Resolved @mentions as {offset, length, user_id} entities
+ALTER TABLE messages ADD COLUMN mentions JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    kind TEXT NOT NULL,
+    actor_id INT NOT NULL,
+    thread_id INT NOT NULL,
+    message_id INT NOT NULL,
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE (user_id, kind, message_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, id);
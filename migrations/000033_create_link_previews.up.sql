@@ -0,0 +1,20 @@
+-- Cached link metadata, failed fetches are kept too so they aren't retried
+-- on every message
+CREATE TABLE link_previews (
+    url TEXT PRIMARY KEY,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    image TEXT NOT NULL DEFAULT '',
+    site_name TEXT NOT NULL DEFAULT '',
+    failed BOOLEAN NOT NULL DEFAULT FALSE,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE message_links (
+    message_id INT NOT NULL,
+    position INT NOT NULL,
+    url TEXT NOT NULL,
+
+    PRIMARY KEY (message_id, position),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
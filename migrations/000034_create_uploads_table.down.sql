@@ -0,0 +1,3 @@
+ALTER TABLE messages DROP COLUMN thumbnail;
+ALTER TABLE messages DROP COLUMN upload_id;
+DROP TABLE IF EXISTS uploads;
@@ -0,0 +1,14 @@
+CREATE TABLE uploads (
+    id TEXT PRIMARY KEY,
+    user_id INT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- An upload can be attached to a single message
+ALTER TABLE messages ADD COLUMN upload_id TEXT UNIQUE REFERENCES uploads(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN thumbnail TEXT NOT NULL DEFAULT '';
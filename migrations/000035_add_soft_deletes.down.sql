@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS threads_deleted_at_idx;
+DROP INDEX IF EXISTS messages_deleted_at_idx;
+ALTER TABLE threads DROP COLUMN deleted_by;
+ALTER TABLE threads DROP COLUMN deleted_at;
+ALTER TABLE messages DROP COLUMN deleted_by;
+ALTER TABLE messages DROP COLUMN deleted_at;
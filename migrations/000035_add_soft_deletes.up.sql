@@ -0,0 +1,9 @@
+-- Deleted messages and threads are kept as tombstones, with their content
+-- only visible to moderators, until the retention job purges them
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN deleted_by INT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE threads ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE threads ADD COLUMN deleted_by INT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX messages_deleted_at_idx ON messages (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX threads_deleted_at_idx ON threads (deleted_at) WHERE deleted_at IS NOT NULL;
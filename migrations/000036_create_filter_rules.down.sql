@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS messages_held_for_review_idx;
+ALTER TABLE threads DROP COLUMN shadow_hidden;
+ALTER TABLE messages DROP COLUMN shadow_hidden;
+ALTER TABLE messages DROP COLUMN held_for_review;
+DROP TABLE IF EXISTS filter_hits;
+DROP TABLE IF EXISTS filter_rules;
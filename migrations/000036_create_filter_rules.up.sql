@@ -0,0 +1,40 @@
+CREATE TABLE filter_rules (
+    id SERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    pattern TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    -- What the rule is for, shown to other moderators
+    note TEXT NOT NULL DEFAULT '',
+    created_by INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Every time a rule matched, kept to tune rules that catch too much or too
+-- little
+CREATE TABLE filter_hits (
+    id SERIAL PRIMARY KEY,
+    rule_id INT NOT NULL,
+    user_id INT NOT NULL,
+    target TEXT NOT NULL,
+    action TEXT NOT NULL,
+    text TEXT NOT NULL,
+    matched TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (rule_id) REFERENCES filter_rules(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX filter_hits_rule_id_idx ON filter_hits (rule_id, id);
+
+-- Held messages wait for a moderator, shadow hidden messages and threads
+-- are only shown to their author
+ALTER TABLE messages ADD COLUMN held_for_review BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE messages ADD COLUMN shadow_hidden BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE threads ADD COLUMN shadow_hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX messages_held_for_review_idx ON messages (id) WHERE held_for_review;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messages_thread_id_user_id_idx;
+ALTER TABLE threads DROP COLUMN slow_mode_seconds;
@@ -0,0 +1,4 @@
+ALTER TABLE threads ADD COLUMN slow_mode_seconds integer NOT NULL DEFAULT 0 CHECK (slow_mode_seconds >= 0);
+
+-- Finds a user's last message in a thread for the slow mode cooldown
+CREATE INDEX messages_thread_id_user_id_idx ON messages (thread_id, user_id, created_at);
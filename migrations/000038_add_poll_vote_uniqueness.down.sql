@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS poll_votes_single_choice_idx;
+ALTER TABLE poll_votes DROP COLUMN multiple_choice;
@@ -0,0 +1,13 @@
+-- Copied from the poll so single choice votes can be unique per user
+ALTER TABLE poll_votes ADD COLUMN multiple_choice BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE poll_votes SET multiple_choice = polls.multiple_choice
+FROM polls WHERE polls.id = poll_votes.poll_id;
+
+-- Racing votes may already have left more than one choice behind, keep the newest
+DELETE FROM poll_votes a USING poll_votes b
+WHERE NOT a.multiple_choice
+  AND a.poll_id = b.poll_id AND a.user_id = b.user_id
+  AND (a.created_at, a.option_id) < (b.created_at, b.option_id);
+
+CREATE UNIQUE INDEX poll_votes_single_choice_idx ON poll_votes (poll_id, user_id) WHERE NOT multiple_choice;
@@ -0,0 +1 @@
+-- The messages stay deleted along with their threads
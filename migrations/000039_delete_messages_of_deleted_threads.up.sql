@@ -0,0 +1,10 @@
+-- Threads used to be soft deleted without their messages
+UPDATE messages SET deleted_at = threads.deleted_at, deleted_by = threads.deleted_by
+FROM threads
+WHERE threads.id = messages.thread_id
+  AND threads.deleted_at IS NOT NULL
+  AND messages.deleted_at IS NULL;
+
+DELETE FROM notifications
+USING messages
+WHERE messages.id = notifications.message_id AND messages.deleted_at IS NOT NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS threads_location_idx;
@@ -0,0 +1 @@
+CREATE INDEX threads_location_idx ON threads (lat, long) WHERE deleted_at IS NULL;
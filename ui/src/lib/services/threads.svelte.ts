@@ -12,13 +12,20 @@ export type Thread = {
   created_at: string;
 };
 
+export type ThreadsResult = {
+  threads: Thread[];
+  // Set when the view holds too many threads to list, threads then only
+  // holds the pinned ones
+  tooMany: boolean;
+};
+
 export async function fetchThreads(
   minLat: number,
   maxLat: number,
   minLong: number,
   maxLong: number,
   mine: boolean
-): Promise<Thread[] | null> {
+): Promise<ThreadsResult | null> {
   let url = `/api/v1/threads?minLat=${minLat}&maxLat=${maxLat}&minLong=${minLong}&maxLong=${maxLong}`;
   if (mine) {
     url = `/api/v1/threads?mine`;
@@ -30,10 +37,10 @@ export async function fetchThreads(
   const json = await res.json();
 
   if (json["error"]) {
-    return null; // Null means too many items
+    return null;
   }
 
-  return json["threads"];
+  return { threads: json["threads"] ?? [], tooMany: !!json["too_many"] };
 }
 
 export async function fetchRandomThread(): Promise<Thread> {